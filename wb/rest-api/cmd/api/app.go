@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"wb/rest-api/internal/auth"
 	"wb/rest-api/internal/config"
 	"wb/rest-api/internal/server"
 	"wb/rest-api/internal/storage/database"
 	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
 )
 
 const (
-	cfgPath = "./config.json"
+	defaultCfgPath = "./config.json"
+	// переменная окружения с путем к конфигу, например "./config.dev.json"
+	cfgPathEnv = "CONFIG_PATH"
 )
 
 func main() {
@@ -16,17 +24,67 @@ func main() {
 	logger.Info("------------------------------------------------------------")
 	logger.Info("NEW APPLICATION")
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfgPath := os.Getenv(cfgPathEnv)
+	if cfgPath == "" {
+		cfgPath = defaultCfgPath
+	}
+
 	cfg, err := config.GetConfig(cfgPath, logger)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	db, err := database.NewDatabaseConnection(cfg.DB, logger)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = migrate(ctx, os.Args[2:], cfg, logger); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg.Auth, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	policy, err := auth.NewPolicy(cfg.Auth, logger)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	srv := server.NewServer(db, logger)
+	var db database.Storage
+	if cfg.Storage == config.StorageMemory {
+		db = database.NewMemoryStorage(cfg.DB, logger)
+	} else {
+		db, err = database.NewDatabaseConnection(ctx, cfg.DB, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	db = database.Instrument(db, registry)
+
+	go database.RunPurge(ctx, db, cfg.DB, logger)
+
+	srv := server.NewServer(db, authenticator, policy, registry, cfg.Listen, logger)
+
+	runErr := srv.Run(ctx)
+	if runErr != nil {
+		logger.Error(runErr)
+	}
+
+	logger.Info("close storage")
+	if err = db.Close(); err != nil {
+		logger.Warningf("failed to close storage: %v", err)
+	}
+
+	// сервер не запустился или не остановился штатно: супервизор должен увидеть ошибку
+	if runErr != nil {
+		os.Exit(1)
+	}
 
-	srv.Run(cfg.Listen)
+	logger.Info("application stopped")
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/internal/storage/database"
+	"wb/rest-api/pkg/logging"
+)
+
+var errMigrateUsage = errors.New("usage: api migrate up | down | status | to <version>")
+
+// migrate выполняет подкоманду "migrate" и не запускает сервер
+func migrate(ctx context.Context, args []string, cfg *config.Config, logger *logging.Logger) error {
+	if cfg.Storage != config.StoragePostgres {
+		return fmt.Errorf("migrations are only supported for %q storage", config.StoragePostgres)
+	}
+
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	db, err := database.Open(ctx, cfg.DB, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q: %v", args[1], convErr)
+		}
+		err = migrator.To(ctx, version)
+	case "status":
+		return printStatus(ctx, migrator)
+	default:
+		return errMigrateUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printStatus(ctx, migrator)
+}
+
+func printStatus(ctx context.Context, migrator *database.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
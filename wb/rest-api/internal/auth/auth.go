@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+const (
+	HeaderAPIKey = "X-API-Key"
+	bearerPrefix = "Bearer "
+)
+
+// способ, которым подтвержден вызывающий
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodNone   = "anonymous"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity -- кто выполняет запрос. ClientId -- клиент, записи которого считаются своими
+type Identity struct {
+	Subject  string
+	Method   string
+	Roles    []string
+	ClientId string
+}
+
+func (i Identity) String() string {
+	return i.Method + ":" + i.Subject
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext возвращает вызывающего, которого сохранил Authenticate
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+type apiKey struct {
+	identity Identity
+	hash     [sha256.Size]byte
+}
+
+// Authenticator проверяет статические API ключи (X-API-Key) и JWT (Authorization: Bearer)
+type Authenticator struct {
+	disabled bool
+	apiKeys  []apiKey
+	jwt      *jwtVerifier
+	logger   *logging.Logger
+}
+
+func NewAuthenticator(cfg config.Auth, logger *logging.Logger) (*Authenticator, error) {
+	a := &Authenticator{
+		disabled: cfg.Disabled,
+		logger:   logger,
+	}
+
+	if a.disabled {
+		logger.Warning("authentication is disabled")
+		return a, nil
+	}
+
+	for _, key := range cfg.APIKeys {
+		if key.Name == "" || key.Key == "" {
+			logger.Warning("api key without name or key")
+			return nil, fmt.Errorf("api key should have name and key")
+		}
+		a.apiKeys = append(a.apiKeys, apiKey{
+			identity: Identity{Subject: key.Name, Method: MethodAPIKey, Roles: key.Roles, ClientId: key.ClientId},
+			hash:     sha256.Sum256([]byte(key.Key)),
+		})
+	}
+
+	verifier, err := newJWTVerifier(cfg.JWT)
+	if err != nil {
+		logger.Warningf("failed to load jwt keys: %v", err)
+		return nil, err
+	}
+	a.jwt = verifier
+
+	logger.Infof("authentication: %d api keys, %d jwt keys", len(a.apiKeys), len(verifier.keys))
+	return a, nil
+}
+
+// Authenticate определяет вызывающего по заголовкам запроса
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if a.disabled {
+		return Identity{Subject: remoteHost(r), Method: MethodNone}, nil
+	}
+
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return a.checkAPIKey(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return Identity{}, ErrMissingCredentials
+	}
+
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return Identity{}, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidCredentials)
+	}
+
+	claims, err := a.jwt.verify(strings.TrimSpace(header[len(bearerPrefix):]))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	return Identity{Subject: claims.Subject, Method: MethodJWT, Roles: claims.Roles, ClientId: claims.ClientId}, nil
+}
+
+// checkAPIKey сравнивает хеши ключей за постоянное время, чтобы не раскрывать ключ по времени ответа
+func (a *Authenticator) checkAPIKey(key string) (Identity, error) {
+	hash := sha256.Sum256([]byte(key))
+	for _, known := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash[:], known.hash[:]) == 1 {
+			return known.identity, nil
+		}
+	}
+
+	return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
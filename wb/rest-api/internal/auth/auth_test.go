@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	a, err := NewAuthenticator(config.Auth{
+		APIKeys: []config.APIKey{{Name: "first", Key: "key-1"}, {Name: "second", Key: "key-2"}},
+	}, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		subject string
+	}{
+		{"key-1", "first"},
+		{"key-2", "second"},
+		{"key-3", ""},
+		{"key-", ""},
+	}
+
+	for _, tt := range tests {
+		identity, err := a.checkAPIKey(tt.key)
+		if tt.subject == "" {
+			if err == nil {
+				t.Errorf("key %q: expected error, got %v", tt.key, identity)
+			}
+			continue
+		}
+		if err != nil || identity.Subject != tt.subject {
+			t.Errorf("key %q: got %v, %v, want %s", tt.key, identity, err, tt.subject)
+		}
+	}
+}
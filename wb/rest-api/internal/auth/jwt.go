@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"wb/rest-api/internal/config"
+)
+
+type jwtKey struct {
+	id        string
+	algorithm string
+	secret    []byte
+	public    *rsa.PublicKey
+}
+
+type jwtVerifier struct {
+	keys     []jwtKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Roles     []string `json:"roles"`
+	ClientId  string   `json:"client_id"`
+}
+
+// audience -- claim aud, который может быть строкой или массивом строк
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud should be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+func newJWTVerifier(cfg config.JWT) (*jwtVerifier, error) {
+	verifier := &jwtVerifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		leeway:   cfg.Leeway.Duration,
+	}
+
+	for _, key := range cfg.Keys {
+		loaded := jwtKey{id: key.Id, algorithm: key.Algorithm}
+		switch key.Algorithm {
+		case config.AlgHS256:
+			if key.Secret == "" {
+				return nil, fmt.Errorf("jwt key %q: secret is required for %s", key.Id, key.Algorithm)
+			}
+			loaded.secret = []byte(key.Secret)
+		case config.AlgRS256:
+			public, err := loadPublicKey(key.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %q: %v", key.Id, err)
+			}
+			loaded.public = public
+		default:
+			return nil, fmt.Errorf("jwt key %q: unsupported alg %q, expected %q or %q",
+				key.Id, key.Algorithm, config.AlgHS256, config.AlgRS256)
+		}
+		verifier.keys = append(verifier.keys, loaded)
+	}
+
+	return verifier, nil
+}
+
+// loadPublicKey читает RSA ключ из PEM: PUBLIC KEY, RSA PUBLIC KEY или CERTIFICATE
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read public key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %s is not a PEM file", path)
+	}
+
+	var public interface{}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			public = cert.PublicKey
+		}
+	default:
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %v", err)
+	}
+
+	rsaKey, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an RSA key", path)
+	}
+
+	return rsaKey, nil
+}
+
+// verify проверяет подпись и сроки токена
+func (v *jwtVerifier) verify(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return jwtClaims{}, fmt.Errorf("malformed token header: %v", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, fmt.Errorf("malformed token signature: %v", err)
+	}
+
+	if !v.checkSignature(header, []byte(parts[0]+"."+parts[1]), signature) {
+		return jwtClaims{}, errors.New("invalid token signature")
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return jwtClaims{}, fmt.Errorf("malformed token claims: %v", err)
+	}
+
+	if err = v.checkClaims(claims, time.Now()); err != nil {
+		return jwtClaims{}, err
+	}
+
+	return claims, nil
+}
+
+// checkSignature ищет ключ по kid и алгоритму заголовка; алгоритм "none" и чужие алгоритмы не принимаются
+func (v *jwtVerifier) checkSignature(header jwtHeader, signed, signature []byte) bool {
+	for _, key := range v.keys {
+		if key.algorithm != header.Algorithm || (header.KeyId != "" && key.id != header.KeyId) {
+			continue
+		}
+		if key.verify(signed, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k jwtKey) verify(signed, signature []byte) bool {
+	switch k.algorithm {
+	case config.AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case config.AlgRS256:
+		hash := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.public, crypto.SHA256, hash[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+func (v *jwtVerifier) checkClaims(claims jwtClaims, now time.Time) error {
+	if claims.Subject == "" {
+		return errors.New("token has no sub")
+	}
+
+	if claims.ExpiresAt == nil {
+		return errors.New("token has no exp")
+	}
+	if now.Add(-v.leeway).After(numericDate(*claims.ExpiresAt)) {
+		return errors.New("token expired")
+	}
+
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(numericDate(*claims.NotBefore)) {
+		return errors.New("token is not valid yet")
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return errors.New("unexpected token issuer")
+	}
+
+	if v.audience != "" && !claims.Audience.contains(v.audience) {
+		return errors.New("unexpected token audience")
+	}
+
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, item := range a {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"wb/rest-api/internal/config"
+)
+
+const testSecret = "test-secret"
+
+// signToken собирает JWT из заголовка и claims и подписывает его key
+func signToken(t *testing.T, header map[string]string, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	var signature []byte
+	switch k := key.(type) {
+	case string:
+		mac := hmac.New(sha256.New, []byte(k))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerify(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &jwtVerifier{
+		keys: []jwtKey{
+			{id: "hs", algorithm: config.AlgHS256, secret: []byte(testSecret)},
+			{id: "rs", algorithm: config.AlgRS256, public: &private.PublicKey},
+		},
+		issuer:   "issuer",
+		audience: "rest-api",
+		leeway:   30 * time.Second,
+	}
+
+	now := time.Now()
+	claims := func(override map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "user",
+			"iss":   "issuer",
+			"aud":   []string{"other", "rest-api"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"admin"},
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	hs := map[string]string{"alg": config.AlgHS256, "kid": "hs"}
+	rs := map[string]string{"alg": config.AlgRS256, "kid": "rs"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"hs256", signToken(t, hs, claims(nil), testSecret), ""},
+		{"rs256", signToken(t, rs, claims(nil), private), ""},
+		{"without kid", signToken(t, map[string]string{"alg": config.AlgHS256}, claims(nil), testSecret), ""},
+		{"wrong secret", signToken(t, hs, claims(nil), "other-secret"), "invalid token signature"},
+		{"unknown kid", signToken(t, map[string]string{"alg": config.AlgHS256, "kid": "missing"}, claims(nil), testSecret),
+			"invalid token signature"},
+		{"kid of other alg", signToken(t, map[string]string{"alg": config.AlgHS256, "kid": "rs"}, claims(nil), testSecret),
+			"invalid token signature"},
+		// RS256 ключ нельзя использовать как HMAC секрет
+		{"alg mismatch", signToken(t, map[string]string{"alg": config.AlgRS256, "kid": "rs"}, claims(nil), testSecret),
+			"invalid token signature"},
+		{"alg none", signToken(t, map[string]string{"alg": "none"}, claims(nil), ""), "invalid token signature"},
+		{"tampered claims", tamper(signToken(t, hs, claims(nil), testSecret)), "invalid token signature"},
+		{"malformed", "not-a-token", "malformed token"},
+		{"expired", signToken(t, hs, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), testSecret),
+			"token expired"},
+		{"expired within leeway", signToken(t, hs, claims(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}),
+			testSecret), ""},
+		{"no exp", signToken(t, hs, claims(map[string]interface{}{"exp": nil}), testSecret), "token has no exp"},
+		{"not before", signToken(t, hs, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), testSecret),
+			"token is not valid yet"},
+		{"not before within leeway", signToken(t, hs, claims(map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()}),
+			testSecret), ""},
+		{"no sub", signToken(t, hs, claims(map[string]interface{}{"sub": nil}), testSecret), "token has no sub"},
+		{"wrong issuer", signToken(t, hs, claims(map[string]interface{}{"iss": "other"}), testSecret),
+			"unexpected token issuer"},
+		{"wrong audience", signToken(t, hs, claims(map[string]interface{}{"aud": "other"}), testSecret),
+			"unexpected token audience"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.verify(tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got.Subject != "user" {
+					t.Fatalf("subject = %q, want %q", got.Subject, "user")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// tamper меняет claims, оставляя подпись исходного токена
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	claims, _ := json.Marshal(map[string]interface{}{"sub": "admin", "exp": time.Now().Add(time.Hour).Unix()})
+	parts[1] = base64.RawURLEncoding.EncodeToString(claims)
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+// ресурсы и действия, на которые выдаются разрешения "<ресурс>:<действие>"
+const (
+	ResourceClients = "clients"
+	ResourceMarkets = "markets"
+
+	ActionRead    = "read"
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionHistory = "history"
+)
+
+var (
+	resources = []string{ResourceClients, ResourceMarkets}
+	actions   = []string{ActionRead, ActionCreate, ActionUpdate, ActionDelete, ActionRestore, ActionHistory}
+)
+
+// суффикс разрешения, которое действует только на записи вызывающего
+const ownSuffix = ":own"
+
+// Scope -- на какие записи распространяется разрешение
+type Scope int
+
+const (
+	ScopeNone Scope = iota
+	ScopeOwn
+	ScopeAll
+)
+
+func Permission(resource, action string) string {
+	return resource + ":" + action
+}
+
+// Policy -- разрешения ролей из конфига. Шаблоны ("*", "clients:*") раскрываются при загрузке
+type Policy struct {
+	disabled bool
+	roles    map[string]map[string]Scope
+}
+
+func NewPolicy(cfg config.Auth, logger *logging.Logger) (*Policy, error) {
+	policy := &Policy{
+		disabled: cfg.Disabled,
+		roles:    make(map[string]map[string]Scope, len(cfg.Roles)),
+	}
+
+	for role, grants := range cfg.Roles {
+		permissions := make(map[string]Scope)
+		for _, grant := range grants {
+			if err := expandGrant(grant, permissions); err != nil {
+				logger.Warningf("invalid permission %q of role %s: %v", grant, role, err)
+				return nil, fmt.Errorf("role %s: invalid permission %q: %v", role, grant, err)
+			}
+		}
+		policy.roles[role] = permissions
+	}
+
+	return policy, nil
+}
+
+// expandGrant добавляет в permissions все разрешения, которые дает grant
+func expandGrant(grant string, permissions map[string]Scope) error {
+	scope := ScopeAll
+	if strings.HasSuffix(grant, ownSuffix) {
+		scope, grant = ScopeOwn, strings.TrimSuffix(grant, ownSuffix)
+	}
+
+	resource, action, found := strings.Cut(grant, ":")
+	if grant == "*" {
+		resource, action, found = "*", "*", true
+	}
+	if !found {
+		return fmt.Errorf("expected <resource>:<action>[:own]")
+	}
+
+	matched := false
+	for _, r := range resources {
+		for _, a := range actions {
+			if (resource == "*" || resource == r) && (action == "*" || action == a) {
+				matched = true
+				if permission := Permission(r, a); permissions[permission] < scope {
+					permissions[permission] = scope
+				}
+			}
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("unknown resource or action")
+	}
+	return nil
+}
+
+// Scope возвращает самое широкое разрешение из ролей вызывающего
+func (p *Policy) Scope(identity Identity, permission string) Scope {
+	if p.disabled {
+		return ScopeAll
+	}
+
+	scope := ScopeNone
+	for _, role := range identity.Roles {
+		if granted := p.roles[role][permission]; granted > scope {
+			scope = granted
+		}
+	}
+	return scope
+}
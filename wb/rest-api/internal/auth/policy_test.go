@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestPolicyScope(t *testing.T) {
+	policy, err := NewPolicy(config.Auth{Roles: map[string][]string{
+		"admin":   {"*"},
+		"support": {"clients:read", "markets:*"},
+		"manager": {"clients:read:own", "markets:update:own", "markets:update"},
+	}}, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		roles      []string
+		permission string
+		scope      Scope
+	}{
+		{[]string{"admin"}, Permission(ResourceClients, ActionDelete), ScopeAll},
+		{[]string{"support"}, Permission(ResourceClients, ActionRead), ScopeAll},
+		{[]string{"support"}, Permission(ResourceClients, ActionCreate), ScopeNone},
+		{[]string{"support"}, Permission(ResourceMarkets, ActionHistory), ScopeAll},
+		{[]string{"manager"}, Permission(ResourceClients, ActionRead), ScopeOwn},
+		// из разрешений на одно действие действует самое широкое
+		{[]string{"manager"}, Permission(ResourceMarkets, ActionUpdate), ScopeAll},
+		{[]string{"manager", "support"}, Permission(ResourceClients, ActionRead), ScopeAll},
+		{[]string{"unknown"}, Permission(ResourceClients, ActionRead), ScopeNone},
+		{nil, Permission(ResourceClients, ActionRead), ScopeNone},
+	}
+
+	for _, tt := range tests {
+		if scope := policy.Scope(Identity{Roles: tt.roles}, tt.permission); scope != tt.scope {
+			t.Errorf("roles %v, %s: scope = %d, want %d", tt.roles, tt.permission, scope, tt.scope)
+		}
+	}
+
+	disabled, err := NewPolicy(config.Auth{Disabled: true}, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope := disabled.Scope(Identity{}, Permission(ResourceClients, ActionDelete)); scope != ScopeAll {
+		t.Errorf("disabled auth: scope = %d, want %d", scope, ScopeAll)
+	}
+}
+
+func TestPolicyInvalidGrant(t *testing.T) {
+	for _, grant := range []string{"clients", "orders:read", "clients:write", "clients:read:all"} {
+		_, err := NewPolicy(config.Auth{Roles: map[string][]string{"role": {grant}}}, logging.GetLogger())
+		if err == nil {
+			t.Errorf("grant %q: expected error", grant)
+		}
+	}
+}
@@ -3,25 +3,163 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"time"
 	"wb/rest-api/pkg/logging"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+const (
+	defaultPurgeInterval = time.Hour
+	defaultMaxBodyBytes  = 1 << 20
+	defaultHealthTimeout = 2 * time.Second
+
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+// что делать с магазинами клиента при его удалении
+const (
+	OnDeleteRestrict = "restrict"
+	OnDeleteCascade  = "cascade"
+	OnDeleteSetNull  = "set_null"
+)
+
+// алгоритмы подписи JWT
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
 type Config struct {
-	DB     Database `json:"DB"`
-	Listen Server   `json:"listen"`
+	Storage string   `json:"storage"`
+	DB      Database `json:"DB"`
+	Listen  Server   `json:"listen"`
+	Auth    Auth     `json:"auth"`
 }
 
+// Database -- подключение к PostgreSQL: либо DSN целиком, либо отдельные параметры
 type Database struct {
+	// строка подключения "host=... dbname=..." или URL "postgres://...", заменяет параметры ниже
+	DSN string `json:"dsn"`
+
+	Host     string `json:"host"`
+	Port     string `json:"port"`
 	User     string `json:"user"`
 	Password string `json:"password"`
 	DBName   string `json:"DBName"`
 	SSLMode  string `json:"SSLMode"`
+	// пути к корневому сертификату сервера, сертификату и ключу клиента (PEM)
+	SSLRootCert     string   `json:"sslRootCert"`
+	SSLCert         string   `json:"sslCert"`
+	SSLKey          string   `json:"sslKey"`
+	ConnectTimeout  Duration `json:"connectTimeout"`
+	ApplicationName string   `json:"applicationName"`
+
+	// пул соединений; 0 -- значение database/sql по умолчанию, MaxIdleConns < 0 -- не держать простаивающие
+	MaxOpenConns    int      `json:"maxOpenConns"`
+	MaxIdleConns    int      `json:"maxIdleConns"`
+	ConnMaxLifetime Duration `json:"connMaxLifetime"`
+	ConnMaxIdleTime Duration `json:"connMaxIdleTime"`
+
+	ConnectRetry ConnectRetry `json:"connectRetry"`
+
+	QueryTimeout        Duration `json:"queryTimeout"`
+	RequireLatestSchema bool     `json:"requireLatestSchema"`
+	OnClientDelete      string   `json:"onClientDelete"`
+
+	// удаленные записи окончательно удаляются через SoftDeleteRetention, 0 -- хранятся бессрочно
+	SoftDeleteRetention Duration `json:"softDeleteRetention"`
+	PurgeInterval       Duration `json:"purgeInterval"`
+}
+
+// ConnectRetry -- ожидание БД при запуске: ping повторяется с экспоненциальной задержкой от InitialBackoff
+// до MaxBackoff со случайным разбросом, пока не истечет Deadline. Deadline 0 -- одна попытка
+type ConnectRetry struct {
+	Deadline       Duration `json:"deadline"`
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+	// если БД так и не ответила, сервер все равно запускается неготовым и переподключается в фоне
+	StartDegraded bool `json:"startDegraded"`
 }
 
 type Server struct {
 	Host string `json:"host"`
 	Port string `json:"port"`
+
+	ReadTimeout       Duration `json:"readTimeout"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	WriteTimeout      Duration `json:"writeTimeout"`
+	IdleTimeout       Duration `json:"idleTimeout"`
+	ShutdownTimeout   Duration `json:"shutdownTimeout"`
+	// сколько после сигнала остановки продолжать принимать запросы с 503 на /readyz,
+	// чтобы балансировщик успел исключить сервер
+	DrainDelay Duration `json:"drainDelay"`
+
+	// максимальный размер тела запроса в байтах, по умолчанию 1 МБ
+	MaxBodyBytes int64     `json:"maxBodyBytes"`
+	RateLimit    RateLimit `json:"rateLimit"`
+	AccessLog    AccessLog `json:"accessLog"`
+
+	// сколько ждать каждую проверку /readyz, по умолчанию 2s
+	HealthTimeout Duration `json:"healthTimeout"`
+}
+
+// AccessLog -- строка в логе на каждый запрос. Ответы с ошибкой (4xx, 5xx) пишутся всегда,
+// остальные -- с вероятностью SampleRate (по умолчанию 1). Запросы к ExcludePaths не пишутся;
+// путь, оканчивающийся на "*", -- префикс
+type AccessLog struct {
+	Disabled     bool     `json:"disabled"`
+	SampleRate   *float64 `json:"sampleRate"`
+	ExcludePaths []string `json:"excludePaths"`
+}
+
+// RateLimit -- token bucket на каждый API ключ или IP: Rate запросов в секунду, до Burst подряд.
+// Rate 0 -- без ограничения
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Auth -- учетные данные, с которыми принимаются запросы.
+// Без ключей сервер не запускается, пока аутентификация не отключена явно
+type Auth struct {
+	Disabled bool     `json:"disabled"`
+	APIKeys  []APIKey `json:"apiKeys"`
+	JWT      JWT      `json:"jwt"`
+
+	// роли и их разрешения вида "<ресурс>:<действие>[:own]", "*" -- все разрешения
+	Roles map[string][]string `json:"roles"`
+}
+
+// APIKey -- статический ключ, Name записывается как автор изменений.
+// ClientId -- клиент, от имени которого действует ключ (для разрешений ":own")
+type APIKey struct {
+	Name     string   `json:"name"`
+	Key      string   `json:"key"`
+	Roles    []string `json:"roles"`
+	ClientId string   `json:"clientId"`
+}
+
+type JWT struct {
+	Keys     []JWTKey `json:"keys"`
+	Issuer   string   `json:"issuer"`
+	Audience string   `json:"audience"`
+	// допустимое расхождение часов при проверке exp и nbf
+	Leeway Duration `json:"leeway"`
+}
+
+// JWTKey -- ключ проверки подписи: Secret для HS256 или PublicKeyFile (PEM) для RS256
+type JWTKey struct {
+	Id            string `json:"kid"`
+	Algorithm     string `json:"alg"`
+	Secret        string `json:"secret"`
+	PublicKeyFile string `json:"publicKeyFile"`
 }
 
 func GetConfig(cfgPath string, logger *logging.Logger) (*Config, error) {
@@ -40,5 +178,89 @@ func GetConfig(cfgPath string, logger *logging.Logger) (*Config, error) {
 		return nil, fmt.Errorf("unable to convert cfg to model: %v", err)
 	}
 
+	if cfg.Storage == "" {
+		cfg.Storage = StoragePostgres
+	}
+
+	if cfg.Storage != StoragePostgres && cfg.Storage != StorageMemory {
+		logger.Warningf("unknown storage: %s", cfg.Storage)
+		return nil, fmt.Errorf("unknown storage %q, expected %q or %q", cfg.Storage, StoragePostgres, StorageMemory)
+	}
+
+	switch cfg.DB.OnClientDelete {
+	case "":
+		cfg.DB.OnClientDelete = OnDeleteRestrict
+	case OnDeleteRestrict, OnDeleteCascade, OnDeleteSetNull:
+	default:
+		logger.Warningf("unknown onClientDelete: %s", cfg.DB.OnClientDelete)
+		return nil, fmt.Errorf("unknown onClientDelete %q, expected %q, %q or %q",
+			cfg.DB.OnClientDelete, OnDeleteRestrict, OnDeleteCascade, OnDeleteSetNull)
+	}
+
+	if cfg.DB.DSN != "" && cfg.DB.hasConnectionParams() {
+		logger.Warning("both dsn and connection parameters configured")
+		return nil, fmt.Errorf("\"DB.dsn\" replaces connection parameters, remove either dsn or host, port, user, " +
+			"password, DBName, SSLMode, ssl certificates, connectTimeout and applicationName")
+	}
+
+	if cfg.DB.MaxOpenConns < 0 || cfg.DB.ConnMaxLifetime.Duration < 0 || cfg.DB.ConnMaxIdleTime.Duration < 0 {
+		logger.Warning("negative db pool settings")
+		return nil, fmt.Errorf("\"DB.maxOpenConns\", \"DB.connMaxLifetime\" and \"DB.connMaxIdleTime\" should not be negative")
+	}
+
+	retry := &cfg.DB.ConnectRetry
+	if retry.InitialBackoff.Duration <= 0 {
+		retry.InitialBackoff.Duration = defaultInitialBackoff
+	}
+	if retry.MaxBackoff.Duration <= 0 {
+		retry.MaxBackoff.Duration = defaultMaxBackoff
+	}
+	if retry.MaxBackoff.Duration < retry.InitialBackoff.Duration {
+		logger.Warningf("db connect max backoff %s is less than initial %s", retry.MaxBackoff, retry.InitialBackoff)
+		return nil, fmt.Errorf("\"DB.connectRetry.maxBackoff\" should not be less than \"initialBackoff\"")
+	}
+
+	if !cfg.Auth.Disabled && len(cfg.Auth.APIKeys) == 0 && len(cfg.Auth.JWT.Keys) == 0 {
+		logger.Warning("no api keys or jwt keys configured")
+		return nil, fmt.Errorf("no api keys or jwt keys configured in %s, add \"auth.apiKeys\" or \"auth.jwt.keys\" "+
+			"or set \"auth.disabled\" to run without authentication", cfgPath)
+	}
+
+	if cfg.Listen.MaxBodyBytes <= 0 {
+		cfg.Listen.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if cfg.Listen.RateLimit.Rate > 0 && cfg.Listen.RateLimit.Burst <= 0 {
+		cfg.Listen.RateLimit.Burst = int(math.Ceil(cfg.Listen.RateLimit.Rate))
+	}
+
+	if cfg.Listen.DrainDelay.Duration < 0 {
+		logger.Warningf("negative drain delay: %s", cfg.Listen.DrainDelay)
+		return nil, fmt.Errorf("\"listen.drainDelay\" should not be negative")
+	}
+
+	if cfg.Listen.HealthTimeout.Duration <= 0 {
+		cfg.Listen.HealthTimeout.Duration = defaultHealthTimeout
+	}
+
+	if rate := cfg.Listen.AccessLog.SampleRate; rate == nil {
+		sampleAll := 1.0
+		cfg.Listen.AccessLog.SampleRate = &sampleAll
+	} else if *rate < 0 || *rate > 1 {
+		logger.Warningf("invalid access log sample rate: %v", *rate)
+		return nil, fmt.Errorf("access log sample rate %v should be between 0 and 1", *rate)
+	}
+
+	if cfg.DB.PurgeInterval.Duration <= 0 {
+		cfg.DB.PurgeInterval.Duration = defaultPurgeInterval
+	}
+
 	return cfg, nil
 }
+
+// hasConnectionParams -- заданы ли параметры, которые заменяет DSN
+func (d Database) hasConnectionParams() bool {
+	return d.Host != "" || d.Port != "" || d.User != "" || d.Password != "" || d.DBName != "" ||
+		d.SSLMode != "" || d.SSLRootCert != "" || d.SSLCert != "" || d.SSLKey != "" ||
+		d.ConnectTimeout.Duration != 0 || d.ApplicationName != ""
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestGetConfigDatabase(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      string
+		wantErr string
+	}{
+		{"parameters", `{"host": "db", "user": "app", "DBName": "wbdb", "maxOpenConns": 5}`, ""},
+		{"dsn", `{"dsn": "postgres://app@db/wbdb", "maxOpenConns": 5}`, ""},
+		{"dsn with parameters", `{"dsn": "postgres://app@db/wbdb", "host": "db"}`, "replaces connection parameters"},
+		{"negative pool size", `{"user": "app", "maxOpenConns": -1}`, "should not be negative"},
+		{"negative lifetime", `{"user": "app", "connMaxLifetime": "-1m"}`, "should not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			data := `{"DB": ` + tt.db + `, "auth": {"disabled": true}}`
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := GetConfig(path, logging.GetLogger())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// конфиги из репозитория: для разработки запускается сразу, основной требует ключей
+func TestShippedConfigs(t *testing.T) {
+	cfg, err := GetConfig(filepath.Join("..", "..", "config.dev.json"), logging.GetLogger())
+	if err != nil {
+		t.Fatalf("config.dev.json: %v", err)
+	}
+	if cfg.Storage != StorageMemory || !cfg.Auth.Disabled {
+		t.Fatalf("config.dev.json: storage %q, auth disabled %v", cfg.Storage, cfg.Auth.Disabled)
+	}
+
+	path := filepath.Join("..", "..", "config.json")
+	if _, err = GetConfig(path, logging.GetLogger()); err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("config.json: error = %v, want error naming the file", err)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+	"wb/rest-api/internal/config"
+)
+
+// statusRecorder запоминает статус и размер ответа для лога и метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(data)
+	rec.bytes += n
+	return n, err
+}
+
+// Status -- код ответа; если обработчик ничего не записал, net/http ответит 200
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// accessLog решает, какие запросы попадают в лог
+type accessLog struct {
+	cfg      config.AccessLog
+	exact    map[string]bool
+	prefixes []string
+}
+
+func newAccessLog(cfg config.AccessLog) *accessLog {
+	a := &accessLog{cfg: cfg, exact: make(map[string]bool)}
+	for _, path := range cfg.ExcludePaths {
+		if strings.HasSuffix(path, "*") {
+			a.prefixes = append(a.prefixes, strings.TrimSuffix(path, "*"))
+		} else {
+			a.exact[path] = true
+		}
+	}
+	return a
+}
+
+func (a *accessLog) excluded(path string) bool {
+	if a.cfg.Disabled || a.exact[path] {
+		return true
+	}
+
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled -- ошибки пишутся всегда, чтобы выборка не прятала их
+func (a *accessLog) sampled(status int) bool {
+	if status >= http.StatusBadRequest {
+		return true
+	}
+
+	rate := 1.0
+	if a.cfg.SampleRate != nil {
+		rate = *a.cfg.SampleRate
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// logAccess пишет одну строку на запрос: кто, что запросил, с каким результатом и за сколько
+func (s *Server) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.accessLog.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.Status()
+		if !s.accessLog.sampled(status) {
+			return
+		}
+
+		// request_id, method и path уже есть в логгере запроса
+		s.log(r).GetLoggerWithFields(map[string]interface{}{
+			"status":      status,
+			"bytes":       rec.bytes,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		}).Info("access")
+	})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"wb/rest-api/internal/auth"
+	"wb/rest-api/internal/storage/database"
+)
+
+// authorize проверяет разрешение "<resource>:<action>" вызывающего.
+// Если разрешение дано только на свои записи (":own"), владельцем должен быть вызывающий
+// и у сохраненной записи stored (загружается только в этом случае), и у нового состояния proposed
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, resource, action string,
+	stored, proposed database.Model) bool {
+	identity, _ := auth.FromContext(r.Context())
+	permission := auth.Permission(resource, action)
+
+	switch s.policy.Scope(identity, permission) {
+	case auth.ScopeAll:
+		return true
+	case auth.ScopeNone:
+		s.forbid(w, r, permission)
+		return false
+	}
+
+	if stored != nil {
+		found, err := s.DB.Get(r.Context(), stored)
+		if err != nil {
+			s.writeStorageError(w, r, err, "get error")
+			return false
+		}
+		stored = found
+	}
+
+	for _, mdl := range []database.Model{stored, proposed} {
+		if mdl != nil && !ownedBy(mdl, identity) {
+			s.forbid(w, r, permission)
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorizeList возвращает клиента, которым нужно ограничить список, если разрешение дано только на свои записи
+func (s *Server) authorizeList(w http.ResponseWriter, r *http.Request, resource string) (*string, bool) {
+	identity, _ := auth.FromContext(r.Context())
+	permission := auth.Permission(resource, auth.ActionRead)
+
+	switch s.policy.Scope(identity, permission) {
+	case auth.ScopeAll:
+		return nil, true
+	case auth.ScopeOwn:
+		if identity.ClientId != "" {
+			return &identity.ClientId, true
+		}
+	}
+
+	s.forbid(w, r, permission)
+	return nil, false
+}
+
+// ownedBy: своя запись клиента -- он сам, своя запись магазина -- магазин, которым он владеет
+func ownedBy(mdl database.Model, identity auth.Identity) bool {
+	var owner *string
+	switch record := mdl.(type) {
+	case database.Client:
+		owner = record.Id
+	case database.Market:
+		owner = record.Owner
+	}
+
+	return identity.ClientId != "" && owner != nil && *owner == identity.ClientId
+}
+
+func (s *Server) forbid(w http.ResponseWriter, r *http.Request, permission string) {
+	s.writeError(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("missing permission %s", permission))
+}
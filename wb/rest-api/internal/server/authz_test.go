@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"wb/rest-api/internal/auth"
+)
+
+func TestAuthorize(t *testing.T) {
+	ts := newTestServer(t)
+	owner, market := createOwnedMarket(t, ts)
+	support := http.Header{auth.HeaderAPIKey: {supportAPIKey}}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{http.MethodGet, "/clients", nil, http.StatusOK},
+		{http.MethodGet, "/clients/" + owner, nil, http.StatusOK},
+		{http.MethodGet, "/markets/" + market, nil, http.StatusOK},
+		{http.MethodPatch, "/clients/" + owner, map[string]interface{}{"age": 30}, http.StatusForbidden},
+		{http.MethodDelete, "/markets/" + market, nil, http.StatusForbidden},
+		{http.MethodGet, "/clients/" + owner + "/history", nil, http.StatusForbidden},
+		{http.MethodPost, "/markets", map[string]interface{}{"name": "Magnit", "address": "Moscow", "active": true},
+			http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			resp, body := doRequest(t, ts, tt.method, tt.path, tt.body, support)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.status, body)
+			}
+
+			var response errorResponse
+			if tt.status == http.StatusForbidden {
+				if err := json.Unmarshal(body, &response); err != nil || response.Error.Code != codeForbidden {
+					t.Fatalf("body %s", body)
+				}
+			}
+		})
+	}
+
+	// запрещенные запросы ничего не меняют
+	if got := getRecord(t, ts, "/clients/"+owner); got["age"] != nil {
+		t.Fatalf("client changed: %v", got)
+	}
+	getRecord(t, ts, "/markets/"+market)
+}
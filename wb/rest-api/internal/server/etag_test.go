@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	ts := newTestServer(t)
+
+	client := map[string]interface{}{
+		"last_name":         "Sokolov",
+		"first_name":        "Petr",
+		"patronymic":        "Igorevich",
+		"registration_date": "01-01-2012",
+	}
+	resp, body := doRequest(t, ts, http.MethodPost, "/clients", client, nil)
+	if etag := resp.Header.Get("ETag"); etag != `"1"` {
+		t.Fatalf("create: ETag = %q, want %q", etag, `"1"`)
+	}
+	path := "/clients/" + createdId(t, resp.StatusCode, body)
+
+	ifMatch := func(tag string) http.Header {
+		if tag == "" {
+			return nil
+		}
+		return http.Header{"If-Match": {tag}}
+	}
+
+	steps := []struct {
+		name    string
+		method  string
+		body    interface{}
+		ifMatch string
+		status  int
+		etag    string // ETag следующего GET
+	}{
+		{"get", http.MethodGet, nil, "", http.StatusOK, `"1"`},
+		{"put current version", http.MethodPut, client, `"1"`, http.StatusOK, `"2"`},
+		{"put stale version", http.MethodPut, client, `"1"`, http.StatusPreconditionFailed, `"2"`},
+		{"patch stale version", http.MethodPatch, map[string]interface{}{"age": 30}, `"1"`, http.StatusPreconditionFailed, `"2"`},
+		{"patch without If-Match", http.MethodPatch, map[string]interface{}{"age": 30}, "", http.StatusOK, `"3"`},
+		{"patch with *", http.MethodPatch, map[string]interface{}{"age": 31}, "*", http.StatusOK, `"4"`},
+		{"malformed If-Match", http.MethodPatch, map[string]interface{}{"age": 32}, "4", http.StatusPreconditionFailed, `"4"`},
+		{"weak ETag", http.MethodPatch, map[string]interface{}{"age": 32}, `W/"4"`, http.StatusPreconditionFailed, `"4"`},
+		{"list without current version", http.MethodPatch, map[string]interface{}{"age": 32}, `"2", "3"`, http.StatusPreconditionFailed, `"4"`},
+		{"list with current version", http.MethodPatch, map[string]interface{}{"age": 32}, `"3", W/"5", "4"`, http.StatusOK, `"5"`},
+		{"delete stale version", http.MethodDelete, nil, `"3"`, http.StatusPreconditionFailed, `"5"`},
+	}
+
+	for _, step := range steps {
+		resp, body := doRequest(t, ts, step.method, path, step.body, ifMatch(step.ifMatch))
+		if resp.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d, body %s", step.name, resp.StatusCode, step.status, body)
+		}
+		if step.status == http.StatusOK && resp.Header.Get("ETag") != step.etag {
+			t.Fatalf("%s: ETag = %q, want %q", step.name, resp.Header.Get("ETag"), step.etag)
+		}
+
+		resp, _ = doRequest(t, ts, http.MethodGet, path, nil, nil)
+		if etag := resp.Header.Get("ETag"); etag != step.etag {
+			t.Fatalf("%s: GET ETag = %q, want %q", step.name, etag, step.etag)
+		}
+	}
+
+	resp, body = doRequest(t, ts, http.MethodDelete, path, nil, ifMatch(`"5"`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete current version: status %d, body %s", resp.StatusCode, body)
+	}
+	if status, _ := do(t, ts, http.MethodGet, path, nil); status != http.StatusNotFound {
+		t.Fatalf("get after delete: status = %d, want 404", status)
+	}
+
+	missing := "/clients/b2d14bbd-94d5-11ed-a690-3aca73727d74"
+	for _, tag := range []string{"*", `"1", "2"`} {
+		resp, body := doRequest(t, ts, http.MethodPatch, missing, map[string]interface{}{"age": 30}, ifMatch(tag))
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("patch missing client with If-Match %s: status %d, body %s", tag, resp.StatusCode, body)
+		}
+	}
+}
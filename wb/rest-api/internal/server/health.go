@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+	"wb/rest-api/internal/storage/database"
+	"wb/rest-api/pkg/logging"
+)
+
+const (
+	healthOk   = "ok"
+	healthFail = "fail"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+type healthResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+type checkResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Healthz -- процесс жив и обрабатывает запросы; зависимости не проверяются,
+// чтобы недоступная БД не приводила к перезапуску сервиса
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusOK, healthResponse{Status: healthOk, Checks: []checkResult{}})
+}
+
+// Readyz -- сервис готов принимать запросы: не останавливается, БД отвечает и мигрирована.
+// Если хоть одна проверка не прошла -- 503
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := append([]database.Check{{Name: "shutdown", Run: s.checkShutdown}}, s.DB.Checks()...)
+
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check database.Check) {
+			defer wg.Done()
+			results[i] = s.runCheck(r.Context(), check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := healthResponse{Status: healthOk, Checks: results}
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status != healthOk {
+			response.Status = healthFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	s.writeJSON(w, r, status, response)
+}
+
+// runCheck ограничивает проверку healthTimeout, чтобы зависшая БД не задерживала ответ пробе
+func (s *Server) runCheck(ctx context.Context, check database.Check) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.HealthTimeout.Duration)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := checkResult{
+		Name:      check.Name,
+		Status:    healthOk,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warningf("readiness check %s failed: %v", check.Name, err)
+		result.Status, result.Error = healthFail, err.Error()
+	}
+	return result
+}
+
+func (s *Server) checkShutdown(context.Context) error {
+	if s.shuttingDown.Load() {
+		return errShuttingDown
+	}
+	return nil
+}
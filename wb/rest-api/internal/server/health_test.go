@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"wb/rest-api/internal/auth"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/internal/storage/database"
+	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
+)
+
+// checkedStorage -- хранилище в памяти с заданными проверками готовности
+type checkedStorage struct {
+	database.Storage
+	checks []database.Check
+}
+
+func (s checkedStorage) Checks() []database.Check {
+	return s.checks
+}
+
+func TestHealthz(t *testing.T) {
+	ts := newTestServer(t)
+
+	// пробы оркестратора приходят без API ключа
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, body := doRequest(t, ts, http.MethodGet, path, nil, http.Header{auth.HeaderAPIKey: {""}})
+		var health healthResponse
+		if err := json.Unmarshal(body, &health); resp.StatusCode != http.StatusOK || err != nil || health.Status != healthOk {
+			t.Fatalf("%s: status %d, body %s", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name         string
+		checks       []database.Check
+		shuttingDown bool
+		status       int
+		failed       []string
+	}{
+		{"all checks pass", []database.Check{{Name: "database", Run: ok}, {Name: "migrations", Run: ok}}, false,
+			http.StatusOK, nil},
+		{"check fails", []database.Check{{Name: "database", Run: ok}, {Name: "migrations", Run: fail}}, false,
+			http.StatusServiceUnavailable, []string{"migrations"}},
+		{"check times out", []database.Check{{Name: "database", Run: hang}}, false,
+			http.StatusServiceUnavailable, []string{"database"}},
+		{"shutting down", []database.Check{{Name: "database", Run: ok}}, true,
+			http.StatusServiceUnavailable, []string{"shutdown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logging.GetLogger()
+			storage := checkedStorage{
+				Storage: database.NewMemoryStorage(config.Database{}, logger),
+				checks:  tt.checks,
+			}
+			srv := NewServer(storage, nil, nil, metrics.NewRegistry(),
+				config.Server{HealthTimeout: config.Duration{Duration: 50 * time.Millisecond}}, logger)
+			srv.shuttingDown.Store(tt.shuttingDown)
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.status, w.Body.String())
+			}
+
+			var health healthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+				t.Fatal(err)
+			}
+			if len(health.Checks) != len(tt.checks)+1 {
+				t.Fatalf("checks: %+v", health.Checks)
+			}
+
+			var failed []string
+			for _, check := range health.Checks {
+				if check.Status != healthOk {
+					if check.Error == "" {
+						t.Fatalf("check %s failed without error", check.Name)
+					}
+					failed = append(failed, check.Name)
+				}
+			}
+			if len(failed) != len(tt.failed) || len(failed) > 0 && failed[0] != tt.failed[0] {
+				t.Fatalf("failed checks = %v, want %v", failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestRunDrain(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	logger := logging.GetLogger()
+	srv := NewServer(database.NewMemoryStorage(config.Database{}, logger), nil, nil, metrics.NewRegistry(),
+		config.Server{
+			Host:          "127.0.0.1",
+			Port:          strconv.Itoa(addr.Port),
+			HealthTimeout: config.Duration{Duration: time.Second},
+			DrainDelay:    config.Duration{Duration: 500 * time.Millisecond},
+		}, logger)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	readyz := func() int {
+		resp, err := http.Get("http://" + addr.String() + "/readyz")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for readyz() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not become ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stop()
+	deadline = time.Now().Add(5 * time.Second)
+	for !srv.shuttingDown.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// до истечения drainDelay сервер отвечает, но уже не готов
+	if status := readyz(); status != http.StatusServiceUnavailable {
+		t.Fatalf("readyz during drain: status = %d, want 503", status)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if status := readyz(); status != 0 {
+		t.Fatalf("readyz after shutdown: status = %d, want connection error", status)
+	}
+}
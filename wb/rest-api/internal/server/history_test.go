@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type historyItem struct {
+	Operation string                 `json:"operation"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	RequestId string                 `json:"request_id"`
+	Caller    string                 `json:"caller"`
+}
+
+func TestHistory(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+		"last_name": "Sokolov", "first_name": "Petr", "patronymic": "Igorevich", "registration_date": "01-01-2012",
+	})
+	path := "/clients/" + createdId(t, status, body)
+
+	doRequest(t, ts, http.MethodPatch, path, map[string]interface{}{"age": 30}, http.Header{headerRequestId: {"patch-1"}})
+	do(t, ts, http.MethodDelete, path, nil)
+	do(t, ts, http.MethodPost, path+"/restore", nil)
+
+	status, body = do(t, ts, http.MethodGet, path+"/history", nil)
+	var history struct {
+		Items []historyItem `json:"items"`
+		Count int           `json:"count"`
+	}
+	if err := json.Unmarshal(body, &history); status != http.StatusOK || err != nil {
+		t.Fatalf("history: status %d, body %s", status, body)
+	}
+
+	operations := []string{"create", "patch", "delete", "restore"}
+	if history.Count != len(operations) || len(history.Items) != len(operations) {
+		t.Fatalf("history: %s", body)
+	}
+	for i, item := range history.Items {
+		if item.Operation != operations[i] {
+			t.Fatalf("item %d: operation = %q, want %q", i, item.Operation, operations[i])
+		}
+		if item.Caller == "" || item.RequestId == "" {
+			t.Fatalf("item %d: no caller or request id: %+v", i, item)
+		}
+	}
+
+	// первая запись -- без состояния до, изменение видно по before/after
+	if history.Items[0].Before != nil || history.Items[0].After["last_name"] != "Sokolov" {
+		t.Fatalf("create entry: %+v", history.Items[0])
+	}
+	patch := history.Items[1]
+	if patch.RequestId != "patch-1" || patch.Before["age"] != nil || patch.After["age"] != float64(30) {
+		t.Fatalf("patch entry: %+v", patch)
+	}
+
+	missing := "/clients/b2d14bbd-94d5-11ed-a690-3aca73727d74/history"
+	if status, _ = do(t, ts, http.MethodGet, missing, nil); status != http.StatusNotFound {
+		t.Fatalf("history of missing client: status = %d, want 404", status)
+	}
+	if status, _ = do(t, ts, http.MethodGet, "/markets/42/history", nil); status != http.StatusBadRequest {
+		t.Fatalf("history with invalid id: status = %d, want 400", status)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testPage struct {
+	Items []struct {
+		Id        string `json:"id"`
+		FirstName string `json:"first_name"`
+	} `json:"items"`
+	Count         int    `json:"count"`
+	Total         int    `json:"total"`
+	NextPageToken string `json:"next_page_token"`
+}
+
+// listClients запрашивает страницу списка клиентов; при статусе не 200 страница пустая
+func listClients(t *testing.T, ts *httptest.Server, filter map[string]interface{}) (int, testPage) {
+	t.Helper()
+
+	var page testPage
+	status, body := do(t, ts, http.MethodGet, "/clients", filter)
+	if status == http.StatusOK {
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatalf("unable to decode list %s: %v", body, err)
+		}
+	}
+	return status, page
+}
+
+// createPaginated создает клиентов с общим отчеством patronymic, по одному на каждое имя
+func createPaginated(t *testing.T, ts *httptest.Server, patronymic string, firstNames ...string) {
+	t.Helper()
+
+	for i, firstName := range firstNames {
+		status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+			"last_name":         "Paginated",
+			"first_name":        firstName,
+			"patronymic":        patronymic,
+			"age":               20 + i,
+			"registration_date": "01-01-2012",
+		})
+		createdId(t, status, body)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	ts := newTestServer(t)
+	createPaginated(t, ts, "Pages", "Anna", "Boris", "Clara", "Denis", "Elena")
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"asc", []string{"Anna", "Boris", "Clara", "Denis", "Elena"}},
+		{"desc", []string{"Elena", "Denis", "Clara", "Boris", "Anna"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			filter := map[string]interface{}{"patronymic": "Pages", "sort_by": "first_name", "order": tt.order, "limit": 2}
+
+			got := make([]string, 0)
+			counts := make([]int, 0)
+			for {
+				status, page := listClients(t, ts, filter)
+				if status != http.StatusOK {
+					t.Fatalf("status %d after %v", status, got)
+				}
+				if page.Total != len(tt.want) {
+					t.Fatalf("total = %d, want %d", page.Total, len(tt.want))
+				}
+				for _, item := range page.Items {
+					got = append(got, item.FirstName)
+				}
+				counts = append(counts, page.Count)
+
+				if page.NextPageToken == "" {
+					break
+				}
+				filter["page_token"] = page.NextPageToken
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if len(counts) != 3 || counts[0] != 2 || counts[1] != 2 || counts[2] != 1 {
+				t.Fatalf("page counts = %v, want [2 2 1]", counts)
+			}
+		})
+	}
+}
+
+func TestListPageTokenReuse(t *testing.T) {
+	ts := newTestServer(t)
+	createPaginated(t, ts, "Tokens", "Anna", "Boris", "Clara")
+
+	status, page := listClients(t, ts, map[string]interface{}{"patronymic": "Tokens", "sort_by": "first_name", "limit": 1})
+	if status != http.StatusOK || page.NextPageToken == "" {
+		t.Fatalf("status %d, page %+v", status, page)
+	}
+
+	tests := []struct {
+		name   string
+		filter map[string]interface{}
+		want   int
+	}{
+		{"same sort", map[string]interface{}{"sort_by": "first_name"}, http.StatusOK},
+		{"other order", map[string]interface{}{"sort_by": "first_name", "order": "desc"}, http.StatusBadRequest},
+		{"other sort_by", map[string]interface{}{"sort_by": "age"}, http.StatusBadRequest},
+		{"default sort_by", map[string]interface{}{}, http.StatusBadRequest},
+		{"malformed", map[string]interface{}{"sort_by": "first_name", "page_token": "not a token"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := map[string]interface{}{"patronymic": "Tokens", "limit": 1, "page_token": page.NextPageToken}
+			for key, value := range tt.filter {
+				filter[key] = value
+			}
+
+			if status, _ := listClients(t, ts, filter); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	ts := newTestServer(t)
+	createPaginated(t, ts, "Limits", "Anna", "Boris", "Clara")
+
+	tests := []struct {
+		limit     int
+		status    int
+		count     int
+		nextToken bool
+	}{
+		{0, http.StatusBadRequest, 0, false},
+		{1, http.StatusOK, 1, true},
+		{500, http.StatusOK, 3, false},
+		{501, http.StatusBadRequest, 0, false},
+	}
+
+	for _, tt := range tests {
+		status, page := listClients(t, ts, map[string]interface{}{"patronymic": "Limits", "limit": tt.limit})
+		if status != tt.status {
+			t.Fatalf("limit %d: status = %d, want %d", tt.limit, status, tt.status)
+		}
+		if page.Count != tt.count || (page.NextPageToken != "") != tt.nextToken {
+			t.Fatalf("limit %d: count = %d, next token %q", tt.limit, page.Count, page.NextPageToken)
+		}
+		if status == http.StatusOK && page.Total != 3 {
+			t.Fatalf("limit %d: total = %d, want 3", tt.limit, page.Total)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+	"wb/rest-api/pkg/metrics"
+)
+
+// routeUnmatched -- метка запросов, путь которых не совпал ни с одним маршрутом:
+// сам путь в метку не попадает, чтобы число серий не зависело от запросов клиентов
+const routeUnmatched = "unmatched"
+
+// methodOther -- метка нестандартных методов: net/http принимает любой токен как метод
+const methodOther = "other"
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+type routeKey struct{}
+
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newHTTPMetrics(registry *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: registry.Counter("http_requests_total",
+			"HTTP requests by route and status.", "method", "route", "status"),
+		duration: registry.Histogram("http_request_duration_seconds",
+			"HTTP request latency by route and status.", metrics.DefaultBuckets, "method", "route", "status"),
+	}
+}
+
+// setRoute сообщает measure шаблон маршрута, которым обработан запрос
+func setRoute(r *http.Request, pattern string) {
+	if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*route = pattern
+	}
+}
+
+// measure считает запросы и их задержку по шаблону маршрута ("/clients/{id}") и статусу ответа
+func (s *Server) measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeUnmatched
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+
+		method := r.Method
+		if !knownMethods[method] {
+			method = methodOther
+		}
+
+		status := strconv.Itoa(rec.Status())
+		s.metrics.requests.Inc(method, route, status)
+		s.metrics.duration.Observe(time.Since(start).Seconds(), method, route, status)
+	})
+}
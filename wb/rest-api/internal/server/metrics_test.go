@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"wb/rest-api/internal/auth"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+		"last_name": "Sokolov", "first_name": "Petr", "patronymic": "Igorevich", "registration_date": "01-01-2012",
+	})
+	id := createdId(t, status, body)
+
+	do(t, ts, http.MethodGet, "/clients/"+id, nil)
+	do(t, ts, http.MethodGet, "/clients/b2d14bbd-94d5-11ed-a690-3aca73727d74", nil)
+	do(t, ts, http.MethodGet, "/unknown/"+id, nil)
+
+	// /metrics отдается без API ключа
+	resp, body := doRequest(t, ts, http.MethodGet, "/metrics", nil, http.Header{auth.HeaderAPIKey: {""}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("metrics: status %d, body %s", resp.StatusCode, body)
+	}
+
+	for _, series := range []string{
+		`http_requests_total{method="POST",route="/clients",status="201"} 1`,
+		`http_requests_total{method="GET",route="/clients/{id}",status="200"} 1`,
+		`http_requests_total{method="GET",route="/clients/{id}",status="404"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/clients/{id}",status="200"} 1`,
+		`storage_operation_duration_seconds_count{model="clients",operation="insert"} 1`,
+		`storage_operation_errors_total{model="clients",operation="get",kind="not_found"} 1`,
+		`http_panics_total 0`,
+	} {
+		if !strings.Contains(string(body), series+"\n") {
+			t.Errorf("no series %s", series)
+		}
+	}
+	if strings.Contains(string(body), "/unknown/") {
+		t.Error("unmatched path should not become a label")
+	}
+}
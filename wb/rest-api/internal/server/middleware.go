@@ -0,0 +1,152 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"wb/rest-api/internal/auth"
+	"wb/rest-api/internal/storage/database"
+	"wb/rest-api/pkg/logging"
+
+	"github.com/google/uuid"
+)
+
+const maxRequestIdLength = 128
+
+// chain оборачивает обработчик в middleware; первая в списке выполняется первой
+func chain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// withRequestId назначает запросу id, если клиент не передал корректный:
+// один id попадает в ответ, в логи запроса и в журнал изменений
+func (s *Server) withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestId)
+		if !validRequestId(id) {
+			id = uuid.NewString()
+			r.Header.Set(headerRequestId, id)
+		}
+		w.Header().Set(headerRequestId, id)
+
+		logger := s.logger.GetLoggerWithFields(map[string]interface{}{
+			"request_id": id,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+		})
+		next.ServeHTTP(w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+	})
+}
+
+// validRequestId не дает записать в логи и заголовки ответа произвольный текст клиента
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// authenticate пропускает только запросы с действующим API ключом или JWT
+// и сохраняет вызывающего в контексте
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := s.auth.Authenticate(r)
+		if err != nil {
+			s.log(r).Warningf("authentication failed: %v", err)
+			// неудачные попытки расходуют корзину IP, чтобы перебор ключей ограничивался
+			if !s.allowRequest(w, r, "ip:"+remoteHost(r)) {
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rest-api"`)
+
+			s.writeError(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		ctx := auth.WithIdentity(r.Context(), identity)
+		ctx = database.WithActor(ctx, database.Actor{RequestId: requestId(r), Caller: identity.String()})
+		ctx = logging.WithLogger(ctx, s.log(r).GetLoggerWithField("caller", identity.String()))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limitBody ограничивает размер тела запроса; больше maxBodyBytes -- 413
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > s.cfg.MaxBodyBytes {
+			s.writeRequestError(w, r, errTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit ограничивает частоту запросов одного вызывающего. Выполняется после аутентификации:
+// ключ из заголовка не годится, пока он не проверен, иначе каждый случайный ключ получал бы свою полную корзину
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + remoteHost(r)
+		if identity, ok := auth.FromContext(r.Context()); ok {
+			key = "id:" + identity.String()
+		}
+
+		if s.allowRequest(w, r, key) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowRequest расходует запрос из корзины key и выставляет заголовки X-RateLimit-*.
+// Если корзина пуста, отвечает 429 и возвращает false
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, key string) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	result := s.limiter.allow(key, time.Now())
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(result.reset)))
+
+	if !result.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(result.retryAfter)))
+		s.writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "too many requests")
+		return false
+	}
+	return true
+}
+
+// seconds округляет вверх: Retry-After и X-RateLimit-Reset передаются целыми секундами
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// log возвращает логгер запроса: с id запроса, методом, путем и, после аутентификации, вызывающим
+func (s *Server) log(r *http.Request) *logging.Logger {
+	return logging.FromContext(r.Context(), s.logger)
+}
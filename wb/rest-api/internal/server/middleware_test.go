@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wb/rest-api/internal/auth"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"valid api key", nil, http.StatusOK},
+		{"no credentials", http.Header{auth.HeaderAPIKey: {""}}, http.StatusUnauthorized},
+		{"unknown api key", http.Header{auth.HeaderAPIKey: {"other-key"}}, http.StatusUnauthorized},
+		{"malformed token", http.Header{auth.HeaderAPIKey: {""}, "Authorization": {"Bearer not-a-token"}},
+			http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, ts, http.MethodGet, "/clients", nil, tt.header)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.status, body)
+			}
+			if tt.status != http.StatusUnauthorized {
+				return
+			}
+
+			var response errorResponse
+			if err := json.Unmarshal(body, &response); err != nil || response.Error.Code != codeUnauthorized {
+				t.Fatalf("body %s", body)
+			}
+			if resp.Header.Get("WWW-Authenticate") == "" {
+				t.Fatal("no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	ts := newTestServer(t)
+
+	large := map[string]interface{}{
+		"last_name": strings.Repeat("a", 1<<20), "first_name": "Petr", "patronymic": "Igorevich",
+		"registration_date": "01-01-2012",
+	}
+	if status, body := do(t, ts, http.MethodPost, "/clients", large); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413, body %s", status, body)
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	srv := NewServer(nil, nil, nil, metrics.NewRegistry(), config.Server{}, logging.GetLogger())
+
+	var logger *logging.Logger
+	handler := srv.withRequestId(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger = logging.FromContext(r.Context(), nil)
+	}))
+
+	tests := []struct {
+		name     string
+		id       string
+		received bool // id клиента попадает в ответ и логи как есть
+	}{
+		{"client id", "req-42", true},
+		{"no id", "", false},
+		{"id with spaces", "req 42", false},
+		{"id with newline", "req\n42", false},
+		{"too long id", strings.Repeat("a", maxRequestIdLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/clients", nil)
+			r.Header.Set(headerRequestId, tt.id)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(headerRequestId)
+			if tt.received && id != tt.id || !tt.received && !validId(id) {
+				t.Fatalf("response request id = %q", id)
+			}
+			if logger == nil || logger.Data["request_id"] != id || logger.Data["method"] != http.MethodGet ||
+				logger.Data["path"] != "/clients" {
+				t.Fatalf("request logger fields: %v", logger)
+			}
+		})
+	}
+}
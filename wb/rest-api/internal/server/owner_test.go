@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wb/rest-api/internal/config"
+)
+
+// createOwnedMarket создает клиента и принадлежащий ему магазин, возвращает их id
+func createOwnedMarket(t *testing.T, ts *httptest.Server) (string, string) {
+	t.Helper()
+
+	status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+		"last_name": "Sokolov", "first_name": "Petr", "patronymic": "Igorevich", "registration_date": "01-01-2012",
+	})
+	owner := createdId(t, status, body)
+
+	status, body = do(t, ts, http.MethodPost, "/markets", map[string]interface{}{
+		"name": "Magnit", "address": "Moscow", "active": true, "owner": owner,
+	})
+	return owner, createdId(t, status, body)
+}
+
+func TestMarketOwner(t *testing.T) {
+	ts := newTestServer(t)
+	owner, market := createOwnedMarket(t, ts)
+
+	_, body := do(t, ts, http.MethodGet, "/clients/"+owner+"/markets", nil)
+	if items := decodeList(t, body); len(items) != 1 || items[0]["id"] != market {
+		t.Fatalf("client markets: %v", items)
+	}
+
+	missing := "b2d14bbd-94d5-11ed-a690-3aca73727d74"
+	if status, _ := do(t, ts, http.MethodGet, "/clients/"+missing+"/markets", nil); status != http.StatusNotFound {
+		t.Fatalf("markets of missing client: status = %d, want 404", status)
+	}
+
+	requests := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]interface{}
+	}{
+		{"create", http.MethodPost, "/markets", map[string]interface{}{
+			"name": "Magnit", "address": "Moscow", "active": true, "owner": missing}},
+		{"update", http.MethodPut, "/markets/" + market, map[string]interface{}{
+			"name": "Magnit", "address": "Moscow", "active": true, "owner": missing}},
+		{"patch", http.MethodPatch, "/markets/" + market, map[string]interface{}{"owner": missing}},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name+" with missing owner", func(t *testing.T) {
+			status, body := do(t, ts, tt.method, tt.path, tt.body)
+			if fields := errorFields(t, body); status != http.StatusBadRequest || len(fields) != 1 || fields[0] != "owner" {
+				t.Fatalf("status %d, body %s", status, body)
+			}
+		})
+	}
+
+	if got := getRecord(t, ts, "/markets/"+market); got["owner"] != owner {
+		t.Fatalf("owner changed by rejected requests: %v", got)
+	}
+}
+
+func TestOnClientDelete(t *testing.T) {
+	tests := []struct {
+		onDelete     string
+		deleteStatus int
+		marketStatus int  // GET магазина после удаления владельца
+		ownerCleared bool // у оставшегося магазина нет владельца
+	}{
+		{config.OnDeleteRestrict, http.StatusConflict, http.StatusOK, false},
+		{config.OnDeleteCascade, http.StatusOK, http.StatusNotFound, false},
+		{config.OnDeleteSetNull, http.StatusOK, http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.onDelete, func(t *testing.T) {
+			ts := newTestServerWith(t, config.Database{OnClientDelete: tt.onDelete})
+			owner, market := createOwnedMarket(t, ts)
+
+			if status, body := do(t, ts, http.MethodDelete, "/clients/"+owner, nil); status != tt.deleteStatus {
+				t.Fatalf("delete owner: status = %d, want %d, body %s", status, tt.deleteStatus, body)
+			}
+
+			status, _ := do(t, ts, http.MethodGet, "/markets/"+market, nil)
+			if status != tt.marketStatus {
+				t.Fatalf("get market: status = %d, want %d", status, tt.marketStatus)
+			}
+			if status == http.StatusOK {
+				_, cleared := getRecord(t, ts, "/markets/"+market)["owner"]
+				if !cleared != tt.ownerCleared {
+					t.Fatalf("owner cleared = %v, want %v", !cleared, tt.ownerCleared)
+				}
+			}
+		})
+	}
+}
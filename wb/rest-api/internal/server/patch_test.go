@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// getRecord возвращает запись по пути вида "/clients/{id}"
+func getRecord(t *testing.T, ts *httptest.Server, path string) map[string]interface{} {
+	t.Helper()
+
+	status, body := do(t, ts, http.MethodGet, path, nil)
+	var record map[string]interface{}
+	if err := json.Unmarshal(body, &record); status != http.StatusOK || err != nil {
+		t.Fatalf("get %s: status %d, body %s", path, status, body)
+	}
+	return record
+}
+
+// errorFields -- поля из ответа с ошибкой валидации
+func errorFields(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var response errorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("unable to decode error %s: %v", body, err)
+	}
+
+	fields := make([]string, 0, len(response.Error.Fields))
+	for _, field := range response.Error.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestClientPatch(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+		"last_name":         "Sokolov",
+		"first_name":        "Petr",
+		"patronymic":        "Igorevich",
+		"age":               30,
+		"registration_date": "01-01-2012",
+	})
+	path := "/clients/" + createdId(t, status, body)
+
+	// переданное поле меняется, остальные остаются как были
+	if status, body = do(t, ts, http.MethodPatch, path, map[string]interface{}{"patronymic": "Ivanovich"}); status != http.StatusOK {
+		t.Fatalf("patch: status %d, body %s", status, body)
+	}
+	got := getRecord(t, ts, path)
+	if got["patronymic"] != "Ivanovich" || got["first_name"] != "Petr" || got["age"] != float64(30) {
+		t.Fatalf("after patch: %v", got)
+	}
+
+	// явный null очищает необязательное поле
+	if status, body = do(t, ts, http.MethodPatch, path, json.RawMessage(`{"age": null}`)); status != http.StatusOK {
+		t.Fatalf("patch null: status %d, body %s", status, body)
+	}
+	got = getRecord(t, ts, path)
+	if _, ok := got["age"]; ok || got["patronymic"] != "Ivanovich" {
+		t.Fatalf("after patch null: %v", got)
+	}
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+		fields []string
+	}{
+		{"null on required field", json.RawMessage(`{"last_name": null}`), http.StatusBadRequest, []string{"last_name"}},
+		{"empty object", json.RawMessage(`{}`), http.StatusBadRequest, []string{""}},
+		{"empty body", nil, http.StatusBadRequest, []string{""}},
+		{"invalid value", map[string]interface{}{"age": 200}, http.StatusBadRequest, []string{"age"}},
+		{"invalid date", map[string]interface{}{"registration_date": "2012-01-01"}, http.StatusBadRequest,
+			[]string{"registration_date"}},
+		{"unknown field", map[string]interface{}{"age": 31, "middle_name": "Ivanovich"}, http.StatusBadRequest,
+			[]string{"middle_name"}},
+		{"read-only field", map[string]interface{}{"age": 31, "version": 10}, http.StatusBadRequest, []string{"version"}},
+		{"id mismatch", map[string]interface{}{"id": "b2d14bbd-94d5-11ed-a690-3aca73727d74", "age": 31},
+			http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, ts, http.MethodPatch, path, tt.body)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", status, tt.status, body)
+			}
+			if tt.fields != nil {
+				if fields := errorFields(t, body); len(fields) != len(tt.fields) || fields[0] != tt.fields[0] {
+					t.Fatalf("fields = %q, want %q", fields, tt.fields)
+				}
+			}
+		})
+	}
+
+	// неудачные запросы ничего не меняют
+	if got = getRecord(t, ts, path); got["last_name"] != "Sokolov" || got["registration_date"] != "01-01-2012" {
+		t.Fatalf("after rejected patches: %v", got)
+	}
+
+	status, _ = do(t, ts, http.MethodPatch, "/clients/b2d14bbd-94d5-11ed-a690-3aca73727d74", map[string]interface{}{"age": 31})
+	if status != http.StatusNotFound {
+		t.Fatalf("patch missing client: status = %d, want 404", status)
+	}
+}
+
+func TestMarketPatch(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, body := do(t, ts, http.MethodPost, "/clients", map[string]interface{}{
+		"last_name": "Sokolov", "first_name": "Petr", "patronymic": "Igorevich", "registration_date": "01-01-2012",
+	})
+	owner := createdId(t, status, body)
+
+	status, body = do(t, ts, http.MethodPost, "/markets", map[string]interface{}{
+		"name": "Magnit", "address": "Moscow", "active": true, "owner": owner,
+	})
+	path := "/markets/" + createdId(t, status, body)
+
+	if status, body = do(t, ts, http.MethodPatch, path, json.RawMessage(`{"owner": null, "active": false}`)); status != http.StatusOK {
+		t.Fatalf("patch: status %d, body %s", status, body)
+	}
+	got := getRecord(t, ts, path)
+	if _, ok := got["owner"]; ok || got["active"] != false || got["name"] != "Magnit" {
+		t.Fatalf("after patch: %v", got)
+	}
+
+	status, body = do(t, ts, http.MethodPatch, path, json.RawMessage(`{"active": null}`))
+	if fields := errorFields(t, body); status != http.StatusBadRequest || len(fields) != 1 || fields[0] != "active" {
+		t.Fatalf("patch active null: status %d, body %s", status, body)
+	}
+
+	status, body = do(t, ts, http.MethodPatch, path, map[string]interface{}{"name": "Magnit", "adress": "Kazan"})
+	if fields := errorFields(t, body); status != http.StatusBadRequest || len(fields) != 1 || fields[0] != "adress" {
+		t.Fatalf("patch unknown field: status %d, body %s", status, body)
+	}
+}
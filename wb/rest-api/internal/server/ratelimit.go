@@ -0,0 +1,94 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+	"wb/rest-api/internal/config"
+)
+
+// простаивающие полные корзины удаляются, чтобы не копить ключи, которые больше не приходят
+const limiterSweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter -- token bucket на каждый ключ: корзина на burst запросов пополняется со скоростью rate в секунду
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// limitResult -- состояние корзины для заголовков X-RateLimit-*
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration
+	reset      time.Duration
+}
+
+// newRateLimiter возвращает nil, если ограничение не задано
+func newRateLimiter(cfg config.RateLimit) *rateLimiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		rate:    cfg.Rate,
+		burst:   float64(cfg.Burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *rateLimiter) allow(key string, now time.Time) limitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := limitResult{limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = l.duration(1 - b.tokens)
+	}
+
+	result.remaining = int(b.tokens)
+	result.reset = l.duration(l.burst - b.tokens)
+	return result
+}
+
+// duration -- за сколько корзина пополнится на tokens запросов
+func (l *rateLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep удаляет корзины, которые успели наполниться. Вызывается под l.mu
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
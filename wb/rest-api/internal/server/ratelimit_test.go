@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+	"time"
+	"wb/rest-api/internal/config"
+)
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	if limiter := newRateLimiter(config.RateLimit{}); limiter != nil {
+		t.Fatalf("expected nil limiter without rate, got %+v", limiter)
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		key        string
+		after      time.Duration // от start
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		cfg   config.RateLimit
+		steps []step
+	}{
+		{
+			name: "burst then deny",
+			cfg:  config.RateLimit{Rate: 1, Burst: 3},
+			steps: []step{
+				{key: "a", allowed: true, remaining: 2},
+				{key: "a", allowed: true, remaining: 1},
+				{key: "a", allowed: true, remaining: 0},
+				{key: "a", allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "refill over time",
+			cfg:  config.RateLimit{Rate: 2, Burst: 2},
+			steps: []step{
+				{key: "a", allowed: true, remaining: 1},
+				{key: "a", allowed: true, remaining: 0},
+				{key: "a", after: 250 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 250 * time.Millisecond},
+				{key: "a", after: 500 * time.Millisecond, allowed: true, remaining: 0},
+				// корзина не наполняется выше burst
+				{key: "a", after: 10 * time.Second, allowed: true, remaining: 1},
+			},
+		},
+		{
+			name: "keys are independent",
+			cfg:  config.RateLimit{Rate: 1, Burst: 1},
+			steps: []step{
+				{key: "a", allowed: true, remaining: 0},
+				{key: "a", allowed: false, remaining: 0, retryAfter: time.Second},
+				{key: "b", allowed: true, remaining: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.cfg)
+			for i, s := range tt.steps {
+				got := limiter.allow(s.key, start.Add(s.after))
+				if got.allowed != s.allowed || got.remaining != s.remaining || got.retryAfter != s.retryAfter {
+					t.Fatalf("step %d: got allowed=%v remaining=%d retryAfter=%s, want allowed=%v remaining=%d retryAfter=%s",
+						i, got.allowed, got.remaining, got.retryAfter, s.allowed, s.remaining, s.retryAfter)
+				}
+				if got.limit != tt.cfg.Burst {
+					t.Fatalf("step %d: limit = %d, want %d", i, got.limit, tt.cfg.Burst)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(config.RateLimit{Rate: 1, Burst: 2})
+
+	limiter.allow("idle", start)
+	// первый вызов уже выполнил очистку, следующая -- не раньше limiterSweepInterval
+	limiter.allow("active", start.Add(limiterSweepInterval))
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Fatal("full idle bucket should be removed")
+	}
+	if _, ok := limiter.buckets["active"]; !ok {
+		t.Fatal("active bucket should be kept")
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanic не дает панике в обработчике оборвать соединение без ответа:
+// стек пишется в лог запроса, клиент получает 500, паника учитывается в счетчике
+func (s *Server) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// так обработчик обрывает ответ намеренно, net/http обрабатывает это сам
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			total := s.panics.Add(1)
+			s.log(r).Errorf("panic: %v (total %d)\n%s", p, total, debug.Stack())
+
+			// если ответ уже начат, статус не изменить -- остается только лог
+			if rec.status != 0 {
+				return
+			}
+			s.writeError(w, r, http.StatusInternalServerError, codeInternal, "internal server error")
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	srv := NewServer(nil, nil, nil, metrics.NewRegistry(), config.Server{}, logging.GetLogger())
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		panics  int64
+	}{
+		{"no panic", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, http.StatusNoContent, 0},
+		{"panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}, http.StatusInternalServerError, 1},
+		{"panic with error", func(w http.ResponseWriter, r *http.Request) {
+			var m map[string]int
+			m["key"]++
+		}, http.StatusInternalServerError, 2},
+		// ответ уже начат -- статус остается прежним, паника только логируется
+		{"panic after write", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("boom")
+		}, http.StatusAccepted, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.recoverPanic(tt.handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/clients", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if srv.panics.Load() != tt.panics {
+				t.Fatalf("panics = %d, want %d", srv.panics.Load(), tt.panics)
+			}
+			if tt.status != http.StatusInternalServerError {
+				return
+			}
+
+			var response errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != codeInternal {
+				t.Fatalf("body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRecoverPanicAbortHandler(t *testing.T) {
+	srv := NewServer(nil, nil, nil, metrics.NewRegistry(), config.Server{}, logging.GetLogger())
+	handler := srv.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	// http.ErrAbortHandler передается дальше в net/http и не считается паникой
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want %v", p, http.ErrAbortHandler)
+		}
+		if srv.panics.Load() != 0 {
+			t.Fatalf("panics = %d, want 0", srv.panics.Load())
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/clients", nil))
+}
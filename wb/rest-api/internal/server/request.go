@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"wb/rest-api/internal/storage/database"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errReadBody   = errors.New("unable to read request body")
+	errTooLarge   = errors.New("request body is too large")
+	errIdMismatch = errors.New("id in request body does not match id in path")
+
+	errIncludeDeleted = errors.New("include_deleted should be a boolean")
+)
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return nil, errTooLarge
+	}
+	if err != nil {
+		return nil, errReadBody
+	}
+	return body, nil
+}
+
+// readRequest читает тело запроса; id из пути ("/clients/{id}") подставляется в тело,
+// чтобы валидация и разбор json были одинаковыми для старых и новых маршрутов
+func readRequest(r *http.Request) ([]byte, error) {
+	request, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(request)) == 0 {
+		request = []byte("{}")
+	}
+
+	id := pathParam(r, "id")
+	if id == "" {
+		return request, nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(request, &fields); err != nil {
+		// ошибку разбора json вернет обработчик
+		return request, nil
+	}
+
+	if bodyId, ok := fields["id"]; ok {
+		var value string
+		if err = json.Unmarshal(bodyId, &value); err != nil || value != id {
+			return nil, errIdMismatch
+		}
+	}
+
+	fields["id"], _ = json.Marshal(id)
+	return json.Marshal(fields)
+}
+
+// readListRequest берет параметры списка из тела запроса, а если оно пустое -- из query string.
+// Значения query string приводятся к типам, которые ожидает схема валидации
+func readListRequest(r *http.Request, intFields, boolFields []string) ([]byte, error) {
+	request, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(request)) != 0 {
+		return request, nil
+	}
+
+	return queryToJSON(r.URL.Query(), intFields, boolFields)
+}
+
+func queryToJSON(query url.Values, intFields, boolFields []string) ([]byte, error) {
+	fields := make(map[string]interface{}, len(query))
+	for key := range query {
+		fields[key] = query.Get(key)
+	}
+
+	for _, key := range intFields {
+		if value, ok := fields[key].(string); ok {
+			if number, err := strconv.Atoi(value); err == nil {
+				fields[key] = number
+			}
+		}
+	}
+
+	for _, key := range boolFields {
+		if value, ok := fields[key].(string); ok {
+			if flag, err := strconv.ParseBool(value); err == nil {
+				fields[key] = flag
+			}
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// ifMatch возвращает версию из заголовка If-Match (RFC 9110, 13.1.1); nil -- запись меняется без проверки версии.
+// Слабые и неразобранные ETag не совпадают никогда, из списка достаточно совпадения одного
+func (s *Server) ifMatch(r *http.Request, mdl database.Model) (*int, error) {
+	header := r.Header.Values("If-Match")
+	if len(header) == 0 {
+		return nil, nil
+	}
+
+	var versions []int
+	wildcard := false
+	for _, line := range header {
+		for _, tag := range strings.Split(line, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				wildcard = true
+				continue
+			}
+			if version, ok := parseETag(tag); ok {
+				versions = append(versions, version)
+			}
+		}
+	}
+
+	switch {
+	case wildcard:
+		// "*" совпадает с любой существующей записью, отсутствующую хранилище вернет как ErrNotFound
+		return nil, nil
+	case len(versions) == 0:
+		return nil, database.ErrVersionMismatch
+	case len(versions) == 1:
+		return &versions[0], nil
+	}
+
+	found, err := s.DB.Get(r.Context(), mdl)
+	if err != nil {
+		return nil, err
+	}
+
+	current := modelVersion(found)
+	for _, version := range versions {
+		if version == current {
+			// хранилище еще раз сравнит версию при изменении
+			return &current, nil
+		}
+	}
+	return nil, database.ErrVersionMismatch
+}
+
+// parseETag разбирает сильный ETag вида "3"
+func parseETag(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+func modelVersion(mdl database.Model) int {
+	var version *int
+	switch m := mdl.(type) {
+	case database.Client:
+		version = m.Version
+	case database.Market:
+		version = m.Version
+	}
+
+	if version == nil {
+		return database.InitialVersion
+	}
+	return *version
+}
+
+// includeDeleted -- нужно ли отдавать удаленную запись (?include_deleted=true)
+func includeDeleted(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errIncludeDeleted
+	}
+
+	return flag, nil
+}
+
+func validId(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+func (s *Server) writeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errTooLarge) {
+		s.writeError(w, r, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+		return
+	}
+	if errors.Is(err, errIdMismatch) || errors.Is(err, errIncludeDeleted) {
+		s.writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	s.writeError(w, r, http.StatusBadRequest, codeBadRequest, "unable to read request body")
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"wb/rest-api/internal/storage/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	headerRequestId = "X-Request-ID"
+)
+
+const (
+	codeBadRequest   = "bad_request"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeTooLarge     = "payload_too_large"
+	codeRateLimited  = "rate_limited"
+	codeInvalidJSON  = "invalid_json"
+	codeValidation   = "validation_failed"
+	codeInvalidId    = "invalid_id"
+	codePageToken    = "invalid_page_token"
+	codeNotFound     = "not_found"
+	codeConflict     = "conflict"
+	codeInvalid      = "invalid_input"
+	codeUnavailable  = "unavailable"
+	codeStale        = "precondition_failed"
+	codeTimeout      = "timeout"
+	codeCanceled     = "canceled"
+	codeInternal     = "internal_error"
+
+	codeMethodNotAllowed = "method_not_allowed"
+)
+
+type listResponse struct {
+	Items []json.RawMessage `json:"items"`
+	// Count -- записей на этой странице, Total -- всего подходящих под фильтр
+	Count         int    `json:"count"`
+	Total         int    `json:"total"`
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+type historyResponse struct {
+	Items []database.AuditEntry `json:"items"`
+	Count int                   `json:"count"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code      string                `json:"code"`
+	Message   string                `json:"message"`
+	RequestId string                `json:"request_id"`
+	Fields    []database.FieldError `json:"fields,omitempty"`
+}
+
+func (s *Server) writeList(w http.ResponseWriter, r *http.Request, page *database.Page) {
+	items := make([]json.RawMessage, 0, len(page.Items))
+	for _, mdl := range page.Items {
+		bytesModel, err := mdl.Marshal(s.log(r))
+		if err != nil {
+			s.writeError(w, r, http.StatusInternalServerError, codeInternal, "unable to marshal model")
+			return
+		}
+		items = append(items, bytesModel)
+	}
+
+	s.writeJSON(w, r, http.StatusOK, listResponse{
+		Items:         items,
+		Count:         len(items),
+		Total:         page.Total,
+		NextPageToken: page.NextPageToken,
+	})
+}
+
+func (s *Server) writeHistory(w http.ResponseWriter, r *http.Request, mdl database.Model) {
+	entries, err := s.DB.History(r.Context(), mdl)
+	if err != nil {
+		s.writeStorageError(w, r, err, "get history error")
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, historyResponse{
+		Items: entries,
+		Count: len(entries),
+	})
+}
+
+// setETag отдает версию записи в заголовке ETag
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+func (s *Server) writeModel(w http.ResponseWriter, r *http.Request, mdl database.Model, version *int) {
+	if version != nil {
+		setETag(w, *version)
+	}
+
+	bytesModel, err := mdl.Marshal(s.log(r))
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, codeInternal, "unable to marshal model")
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, json.RawMessage(bytesModel))
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, codeInternal, "unable to marshal response")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	s.writeErrorBody(w, r, status, errorBody{
+		Code:      code,
+		Message:   msg,
+		RequestId: requestId(r),
+	})
+}
+
+func (s *Server) writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	body := errorBody{
+		Code:      codeValidation,
+		Message:   "validation fail",
+		RequestId: requestId(r),
+	}
+
+	var validationErr *database.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Fields = validationErr.Fields
+	}
+
+	s.writeErrorBody(w, r, http.StatusBadRequest, body)
+}
+
+func (s *Server) writeErrorBody(w http.ResponseWriter, r *http.Request, status int, body errorBody) {
+	s.log(r).Warningf("error: status-[%d]; code-[%s]; msg-[%s]", status, body.Code, body.Message)
+
+	response, err := json.Marshal(errorResponse{Error: body})
+	if err != nil {
+		s.log(r).Warningf("unable to marshal error response: %v", err)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func (s *Server) writeStorageError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		s.writeError(w, r, http.StatusNotFound, codeNotFound, "record not found")
+	case errors.Is(err, database.ErrOwnerNotFound):
+		s.writeErrorBody(w, r, http.StatusBadRequest, errorBody{
+			Code:      codeValidation,
+			Message:   "validation fail",
+			RequestId: requestId(r),
+			Fields:    []database.FieldError{{Field: "owner", Message: "owner client not found"}},
+		})
+	case errors.Is(err, database.ErrOwnerHasMarkets):
+		s.writeError(w, r, http.StatusConflict, codeConflict, "client owns markets")
+	case errors.Is(err, database.ErrNotDeleted):
+		s.writeError(w, r, http.StatusConflict, codeConflict, "record is not deleted")
+	case errors.Is(err, database.ErrVersionMismatch):
+		s.writeError(w, r, http.StatusPreconditionFailed, codeStale, "record was modified, version does not match If-Match")
+	case errors.Is(err, database.ErrConflict):
+		s.writeError(w, r, http.StatusConflict, codeConflict, "record conflicts with existing data")
+	case errors.Is(err, database.ErrInvalidInput):
+		s.writeError(w, r, http.StatusBadRequest, codeInvalid, "invalid input")
+	case errors.Is(err, database.ErrUnavailable):
+		s.writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "storage unavailable")
+	case errors.Is(err, database.ErrInvalidPageToken):
+		s.writeError(w, r, http.StatusBadRequest, codePageToken, "invalid page token")
+	case errors.Is(err, database.ErrQueryTimeout):
+		s.writeError(w, r, http.StatusGatewayTimeout, codeTimeout, "query timeout")
+	case errors.Is(err, database.ErrQueryCanceled):
+		s.writeError(w, r, statusClientClosedRequest, codeCanceled, "request canceled")
+	default:
+		s.writeError(w, r, http.StatusInternalServerError, codeInternal, msg)
+	}
+}
+
+// requestId берет идентификатор из заголовка запроса, либо генерирует новый
+func requestId(r *http.Request) string {
+	if id := r.Header.Get(headerRequestId); id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
+
+func setResponseId(id string) map[string]string {
+	responseMap := make(map[string]string)
+	responseMap["id"] = id
+	return responseMap
+}
+
+func setStatus(status string) map[string]string {
+	responseMap := make(map[string]string)
+	responseMap["status"] = status
+	return responseMap
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"wb/rest-api/internal/config"
+)
+
+func TestRestore(t *testing.T) {
+	ts := newTestServerWith(t, config.Database{OnClientDelete: config.OnDeleteCascade})
+	owner, market := createOwnedMarket(t, ts)
+	clientPath, marketPath := "/clients/"+owner, "/markets/"+market
+
+	if status, body := do(t, ts, http.MethodPost, clientPath+"/restore", nil); status != http.StatusConflict {
+		t.Fatalf("restore not deleted client: status %d, body %s", status, body)
+	}
+
+	if status, body := do(t, ts, http.MethodDelete, clientPath, nil); status != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", status, body)
+	}
+
+	// удаленная запись скрыта, но доступна с include_deleted
+	for _, path := range []string{clientPath, marketPath} {
+		if status, _ := do(t, ts, http.MethodGet, path, nil); status != http.StatusNotFound {
+			t.Fatalf("get deleted %s: status = %d, want 404", path, status)
+		}
+		if got := getRecord(t, ts, path+"?include_deleted=true"); got["deleted_at"] == nil {
+			t.Fatalf("get deleted %s with include_deleted: %v", path, got)
+		}
+	}
+	if status, _ := do(t, ts, http.MethodGet, clientPath+"?include_deleted=yes", nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid include_deleted: status = %d, want 400", status)
+	}
+	if status, _ := do(t, ts, http.MethodPatch, clientPath, map[string]interface{}{"age": 30}); status != http.StatusNotFound {
+		t.Fatalf("patch deleted client: status = %d, want 404", status)
+	}
+
+	// восстановление клиента возвращает и магазины, удаленные каскадом
+	if status, body := do(t, ts, http.MethodPost, clientPath+"/restore", nil); status != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s", status, body)
+	}
+	for _, path := range []string{clientPath, marketPath} {
+		if got := getRecord(t, ts, path); got["deleted_at"] != nil {
+			t.Fatalf("get restored %s: %v", path, got)
+		}
+	}
+
+	missing := "/markets/b2d14bbd-94d5-11ed-a690-3aca73727d74/restore"
+	if status, _ := do(t, ts, http.MethodPost, missing, nil); status != http.StatusNotFound {
+		t.Fatalf("restore missing market: status = %d, want 404", status)
+	}
+}
+
+func TestRestoreDeletedOwner(t *testing.T) {
+	ts := newTestServerWith(t, config.Database{OnClientDelete: config.OnDeleteCascade})
+	owner, market := createOwnedMarket(t, ts)
+
+	do(t, ts, http.MethodDelete, "/clients/"+owner, nil)
+
+	// магазин нельзя восстановить, пока удален его владелец
+	status, body := do(t, ts, http.MethodPost, "/markets/"+market+"/restore", nil)
+	if fields := errorFields(t, body); status != http.StatusBadRequest || len(fields) != 1 || fields[0] != "owner" {
+		t.Fatalf("restore market of deleted owner: status %d, body %s", status, body)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type paramsKey struct{}
+
+// router сопоставляет путь с шаблонами вида "/clients/{id}" и проверяет метод запроса
+type router struct {
+	routes []*route
+
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	handlers map[string]http.HandlerFunc
+}
+
+func newRouter() *router {
+	return &router{
+		notFound:         http.NotFound,
+		methodNotAllowed: http.NotFound,
+	}
+}
+
+func (rt *router) handle(method, pattern string, handler http.HandlerFunc) {
+	segments := splitPath(pattern)
+	for _, rte := range rt.routes {
+		if equalSegments(rte.segments, segments) {
+			rte.handlers[method] = handler
+			return
+		}
+	}
+
+	rt.routes = append(rt.routes, &route{
+		pattern:  pattern,
+		segments: segments,
+		handlers: map[string]http.HandlerFunc{method: handler},
+	})
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.Path)
+	for _, rte := range rt.routes {
+		params, ok := rte.match(path)
+		if !ok {
+			continue
+		}
+
+		setRoute(r, rte.pattern)
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+		}
+
+		handler, ok := rte.handlers[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			// HEAD обслуживается обработчиком GET, тело ответа net/http не отправляет
+			handler, ok = rte.handlers[http.MethodGet]
+		}
+		if !ok {
+			w.Header().Set("Allow", strings.Join(rte.methods(), ", "))
+			rt.methodNotAllowed(w, r)
+			return
+		}
+
+		handler(w, r)
+		return
+	}
+
+	rt.notFound(w, r)
+}
+
+func (rte *route) match(path []string) (map[string]string, bool) {
+	if len(path) != len(rte.segments) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, segment := range rte.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// methods -- значение заголовка Allow: методы маршрута и HEAD, если есть GET
+func (rte *route) methods() []string {
+	methods := make([]string, 0, len(rte.handlers)+1)
+	for method := range rte.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rte.handlers[http.MethodGet]; ok {
+		if _, ok = rte.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// pathParam возвращает значение параметра из шаблона пути, например "id" для "/clients/{id}"
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func equalSegments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + pathParam(r, "id")))
+		}
+	}
+
+	rt := newRouter()
+	rt.methodNotAllowed = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+	rt.handle(http.MethodGet, "/clients", handler("list"))
+	rt.handle(http.MethodPost, "/clients", handler("create"))
+	rt.handle(http.MethodPut, "/clients/{id}", handler("update"))
+	rt.handle(http.MethodDelete, "/clients/{id}", handler("delete"))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+		allow  string
+	}{
+		{http.MethodGet, "/clients", http.StatusOK, "list:", ""},
+		{http.MethodPost, "/clients/", http.StatusOK, "create:", ""},
+		{http.MethodPut, "/clients/42", http.StatusOK, "update:42", ""},
+		{http.MethodDelete, "/clients/42", http.StatusOK, "delete:42", ""},
+		{http.MethodHead, "/clients", http.StatusOK, "list:", ""},
+		{http.MethodDelete, "/clients", http.StatusMethodNotAllowed, "", "GET, HEAD, POST"},
+		{http.MethodPost, "/clients/42", http.StatusMethodNotAllowed, "", "DELETE, PUT"},
+		{http.MethodHead, "/clients/42", http.StatusMethodNotAllowed, "", "DELETE, PUT"},
+		{http.MethodGet, "/clients/42/markets", http.StatusNotFound, "", ""},
+		{http.MethodGet, "/", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Fatalf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Fatalf("Allow = %q, want %q", allow, tt.allow)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPatch, "/clients", "GET, HEAD, POST"},
+		{http.MethodPost, "/clients/42", "DELETE, GET, HEAD, PATCH, PUT"},
+		{http.MethodPost, "/markets/42", "DELETE, GET, HEAD, PATCH, PUT"},
+		{http.MethodPost, "/client/list", "GET, HEAD"},
+		{http.MethodGet, "/market/delete", "DELETE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			resp, _ := doRequest(t, ts, tt.method, tt.path, nil, nil)
+			if resp.StatusCode != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", resp.StatusCode)
+			}
+			if allow := resp.Header.Get("Allow"); allow != tt.allow {
+				t.Fatalf("Allow = %q, want %q", allow, tt.allow)
+			}
+		})
+	}
+
+	if status, _ := do(t, ts, http.MethodGet, "/unknown", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown route: status = %d, want 404", status)
+	}
+
+	// HEAD отвечает как GET, но без тела
+	resp, body := doRequest(t, ts, http.MethodHead, "/clients", nil, nil)
+	if resp.StatusCode != http.StatusOK || len(body) != 0 || resp.Header.Get("Content-Type") == "" {
+		t.Fatalf("HEAD /clients: status %d, headers %v, body %q", resp.StatusCode, resp.Header, body)
+	}
+}
@@ -1,342 +1,790 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
+	"wb/rest-api/internal/auth"
 	"wb/rest-api/internal/config"
 	"wb/rest-api/internal/storage/database"
 	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
 )
 
 const (
 	success = "success"
+
+	// нестандартный статус (nginx) для запросов, клиент которых отключился
+	statusClientClosedRequest = 499
+
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+var _ http.Handler = &Server{}
+
+// поля query string, которые нужно передать в валидацию числами и булевыми значениями
+var (
+	clientIntFields  = []string{"age_from", "age_to", "limit"}
+	clientBoolFields = []string{"include_deleted"}
+	marketIntFields  = []string{"limit"}
+	marketBoolFields = []string{"active", "include_deleted"}
 )
 
 type Server struct {
-	logger *logging.Logger
-	DB     database.Storage
+	logger    *logging.Logger
+	DB        database.Storage
+	router    *router
+	handler   http.Handler
+	auth      *auth.Authenticator
+	policy    *auth.Policy
+	limiter   *rateLimiter
+	accessLog *accessLog
+	metrics   *httpMetrics
+	// служебные маршруты по точному пути, без аутентификации
+	internal map[string]http.Handler
+	// паники, перехваченные recoverPanic
+	panics atomic.Int64
+	// после сигнала остановки /readyz отвечает 503
+	shuttingDown atomic.Bool
+	cfg          config.Server
+	httpServer   *http.Server
 }
 
-func (s *Server) Run(cfg config.Server) {
-	s.logger.Infof("run server (%s:%s)", cfg.Host, cfg.Port)
+// Run запускает сервер и блокируется до отмены ctx, после чего еще drainDelay
+// принимает запросы (/readyz отвечает 503) и дожидается завершения текущих в течение shutdownTimeout
+func (s *Server) Run(ctx context.Context) error {
+	cfg := s.cfg
+	s.httpServer = &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Handler:           s,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Infof("run server (%s)", s.httpServer.Addr)
+		errCh <- s.httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		s.logger.Warningf("server stopped: %v", err)
+		return fmt.Errorf("listen error: %v", err)
+	case <-ctx.Done():
+	}
+
+	grace := cfg.ShutdownTimeout.Duration
+	if grace <= 0 {
+		grace = defaultShutdownTimeout
+	}
+
+	s.shuttingDown.Store(true)
+	if delay := cfg.DrainDelay.Duration; delay > 0 {
+		s.logger.Infof("shutting down server, serving requests for %s before shutdown", delay)
+		select {
+		case err := <-errCh:
+			s.logger.Warningf("server stopped: %v", err)
+			return fmt.Errorf("listen error: %v", err)
+		case <-time.After(delay):
+		}
+	}
 
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%s", cfg.Host, cfg.Port), nil); err != nil {
-		s.logger.Fatal()
+	s.logger.Infof("shutting down server, waiting for in-flight requests up to %s", grace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		s.logger.Warningf("failed to shut down server gracefully: %v", err)
+		return fmt.Errorf("shutdown error: %v", err)
 	}
+
+	s.logger.Info("server stopped")
+	return nil
 }
 
-func NewServer(database database.Storage, logger *logging.Logger) *Server {
+func NewServer(database database.Storage, authenticator *auth.Authenticator, policy *auth.Policy,
+	registry *metrics.Registry, cfg config.Server, logger *logging.Logger) *Server {
 	logger.Info("init server")
 
 	server := &Server{
-		logger: logger,
-		DB:     database,
+		logger:    logger,
+		DB:        database,
+		router:    newRouter(),
+		auth:      authenticator,
+		policy:    policy,
+		limiter:   newRateLimiter(cfg.RateLimit),
+		accessLog: newAccessLog(cfg.AccessLog),
+		metrics:   newHTTPMetrics(registry),
+		internal:  make(map[string]http.Handler),
+		cfg:       cfg,
 	}
 
+	registry.CounterFunc("http_panics_total", "Panics recovered in HTTP handlers.",
+		func() float64 { return float64(server.panics.Load()) })
+
 	server.InitRoutes()
+	server.internal["/metrics"] = registry.Handler()
+	server.internal["/healthz"] = http.HandlerFunc(server.Healthz)
+	server.internal["/readyz"] = http.HandlerFunc(server.Readyz)
+
+	api := chain(server.router,
+		server.limitBody,
+		server.authenticate,
+		server.rateLimit,
+	)
+	server.handler = chain(server.routeInternal(api),
+		server.withRequestId,
+		server.logAccess,
+		server.measure,
+		server.recoverPanic,
+	)
 
 	return server
 }
 
+// routeInternal отдает служебные маршруты в обход аутентификации и ограничения частоты:
+// их опрашивают мониторинг и оркестратор, а не клиенты API
+func (s *Server) routeInternal(api http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := s.internal[r.URL.Path]
+		if !ok {
+			api.ServeHTTP(w, r)
+			return
+		}
+
+		setRoute(r, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
 func (s *Server) InitRoutes() {
-	http.HandleFunc("/client/list", s.ClientList)
-	http.HandleFunc("/client/create", s.ClientCreate)
-	http.HandleFunc("/client/update", s.ClientUpdate)
-	http.HandleFunc("/client/delete", s.ClientDelete)
-	http.HandleFunc("/market/list", s.MarketList)
-	http.HandleFunc("/market/create", s.MarketCreate)
-	http.HandleFunc("/market/update", s.MarketUpdate)
-	http.HandleFunc("/market/delete", s.MarketDelete)
+	s.router.notFound = s.NotFound
+	s.router.methodNotAllowed = s.MethodNotAllowed
+
+	s.router.handle(http.MethodGet, "/clients", s.ClientList)
+	s.router.handle(http.MethodPost, "/clients", s.ClientCreate)
+	s.router.handle(http.MethodGet, "/clients/{id}", s.ClientGet)
+	s.router.handle(http.MethodGet, "/clients/{id}/markets", s.ClientMarkets)
+	s.router.handle(http.MethodPut, "/clients/{id}", s.ClientUpdate)
+	s.router.handle(http.MethodPatch, "/clients/{id}", s.ClientPatch)
+	s.router.handle(http.MethodDelete, "/clients/{id}", s.ClientDelete)
+	s.router.handle(http.MethodPost, "/clients/{id}/restore", s.ClientRestore)
+	s.router.handle(http.MethodGet, "/clients/{id}/history", s.ClientHistory)
+	s.router.handle(http.MethodGet, "/markets", s.MarketList)
+	s.router.handle(http.MethodPost, "/markets", s.MarketCreate)
+	s.router.handle(http.MethodGet, "/markets/{id}", s.MarketGet)
+	s.router.handle(http.MethodPut, "/markets/{id}", s.MarketUpdate)
+	s.router.handle(http.MethodPatch, "/markets/{id}", s.MarketPatch)
+	s.router.handle(http.MethodDelete, "/markets/{id}", s.MarketDelete)
+	s.router.handle(http.MethodPost, "/markets/{id}/restore", s.MarketRestore)
+	s.router.handle(http.MethodGet, "/markets/{id}/history", s.MarketHistory)
+
+	// старые пути оставлены для совместимости
+	s.router.handle(http.MethodGet, "/client/list", s.ClientList)
+	s.router.handle(http.MethodPost, "/client/create", s.ClientCreate)
+	s.router.handle(http.MethodPut, "/client/update", s.ClientUpdate)
+	s.router.handle(http.MethodDelete, "/client/delete", s.ClientDelete)
+	s.router.handle(http.MethodGet, "/market/list", s.MarketList)
+	s.router.handle(http.MethodPost, "/market/create", s.MarketCreate)
+	s.router.handle(http.MethodPut, "/market/update", s.MarketUpdate)
+	s.router.handle(http.MethodDelete, "/market/delete", s.MarketDelete)
+}
+
+func (s *Server) NotFound(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, r, http.StatusNotFound, codeNotFound, "route not found")
+}
+
+func (s *Server) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed,
+		fmt.Sprintf("method %s is not allowed", r.Method))
 }
 
 func (s *Server) ClientList(w http.ResponseWriter, r *http.Request) {
-	var client database.Client
-	request, err := io.ReadAll(r.Body)
+	var filter database.ClientFilter
+	request, err := readListRequest(r, clientIntFields, clientBoolFields)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
-	if err = json.Unmarshal(request, &client); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+	// сначала валидация: неверные типы в query string должны вернуть ошибку по полю
+	if err = filter.Validate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
+		return
+	}
+
+	if err = json.Unmarshal(request, &filter); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	if err = client.ValidateForList(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	owner, ok := s.authorizeList(w, r, auth.ResourceClients)
+	if !ok {
 		return
 	}
+	if owner != nil {
+		filter.Id = owner
+	}
 
-	list, err := s.DB.GetList(client)
+	page, err := s.DB.GetList(r.Context(), filter)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "get list error", s.logger)
+		s.writeStorageError(w, r, err, "get list error")
 		return
 	}
 
-	response := make([]byte, 0)
-	for _, mdl := range list {
-		bytesModel, err := mdl.Marshal(s.logger)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "unable to marshal model", s.logger)
-			return
-		}
-		response = append(response, bytesModel...)
+	s.writeList(w, r, page)
+}
+
+func (s *Server) ClientGet(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	withDeleted, err := includeDeleted(r)
+	if err != nil {
+		s.writeRequestError(w, r, err)
+		return
+	}
+
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionRead, database.Client{Id: &id}, nil) {
+		return
 	}
 
-	w.Write(response)
+	found, err := s.DB.Get(r.Context(), database.Client{Id: &id})
+	if err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	client := found.(database.Client)
+	if client.DeletedAt != nil && !withDeleted {
+		s.writeStorageError(w, r, database.ErrNotFound, "get error")
+		return
+	}
+
+	s.writeModel(w, r, client, client.Version)
+}
+
+// ClientMarkets -- список магазинов, владельцем которых является клиент
+func (s *Server) ClientMarkets(w http.ResponseWriter, r *http.Request) {
+	var filter database.MarketFilter
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	request, err := readListRequest(r, marketIntFields, marketBoolFields)
+	if err != nil {
+		s.writeRequestError(w, r, err)
+		return
+	}
+
+	if err = filter.Validate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
+		return
+	}
+
+	if err = json.Unmarshal(request, &filter); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
+		return
+	}
+
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionRead, nil, database.Market{Owner: &id}) {
+		return
+	}
+
+	found, err := s.DB.Get(r.Context(), database.Client{Id: &id})
+	if err == nil && found.(database.Client).DeletedAt != nil && !filter.IncludeDeleted {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	filter.Owner = &id
+	page, err := s.DB.GetList(r.Context(), filter)
+	if err != nil {
+		s.writeStorageError(w, r, err, "get list error")
+		return
+	}
+
+	s.writeList(w, r, page)
 }
 
 func (s *Server) ClientCreate(w http.ResponseWriter, r *http.Request) {
 	var client database.Client
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &client); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	if err = client.ValidateForCreate(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if err = client.ValidateForCreate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	id, err := s.DB.Insert(client)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "insert error", s.logger)
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionCreate, nil, client) {
 		return
 	}
 
-	response, err := json.Marshal(setResponseId(id))
+	id, err := s.DB.Insert(r.Context(), client)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeStorageError(w, r, err, "insert error")
 		return
 	}
 
-	w.Write(response)
+	w.Header().Set("Location", "/clients/"+id)
+	setETag(w, database.InitialVersion)
+	s.writeJSON(w, r, http.StatusCreated, setResponseId(id))
 }
 
 func (s *Server) ClientUpdate(w http.ResponseWriter, r *http.Request) {
 	var client database.Client
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &client); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
+		return
+	}
+
+	if err = client.ValidateForUpdate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	if err = client.ValidateForUpdate(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionUpdate, database.Client{Id: client.Id}, client) {
 		return
 	}
 
-	err = s.DB.Update(client)
+	if client.Version, err = s.ifMatch(r, client); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Update(r.Context(), client)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "update error", s.logger)
+		s.writeStorageError(w, r, err, "update error")
 		return
 	}
 
-	response, err := json.Marshal(setStatus(success))
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
+}
+
+func (s *Server) ClientPatch(w http.ResponseWriter, r *http.Request) {
+	var client database.Client
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
-	w.Write(response)
+	// валидация до разбора: в PATCH важно отличать отсутствующее поле от null
+	if err = client.ValidateForPatch(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
+		return
+	}
+
+	patch, err := client.ParsePatch(request)
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
+		return
+	}
+
+	id := pathParam(r, "id")
+	client.Id = &id
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionUpdate, database.Client{Id: &id}, nil) {
+		return
+	}
+
+	if client.Version, err = s.ifMatch(r, client); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Patch(r.Context(), client, patch)
+	if err != nil {
+		s.writeStorageError(w, r, err, "patch error")
+		return
+	}
+
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
 }
 
 func (s *Server) ClientDelete(w http.ResponseWriter, r *http.Request) {
 	var client database.Client
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &client); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	if err = client.ValidateForDelete(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if err = client.ValidateForDelete(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	err = s.DB.Delete(client)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "delete error", s.logger)
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionDelete, database.Client{Id: client.Id}, nil) {
 		return
 	}
 
-	response, err := json.Marshal(setStatus(success))
+	if client.Version, err = s.ifMatch(r, client); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	err = s.DB.Delete(r.Context(), client)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeStorageError(w, r, err, "delete error")
 		return
 	}
 
-	w.Write(response)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
 }
 
-func (s *Server) MarketList(w http.ResponseWriter, r *http.Request) {
-	var market database.Market
-	request, err := io.ReadAll(r.Body)
+// ClientRestore снимает с клиента пометку удаления
+func (s *Server) ClientRestore(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	var err error
+	client := database.Client{Id: &id}
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionRestore, database.Client{Id: &id}, nil) {
+		return
+	}
+
+	if client.Version, err = s.ifMatch(r, client); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Restore(r.Context(), client)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeStorageError(w, r, err, "restore error")
 		return
 	}
 
-	if err = json.Unmarshal(request, &market); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
+}
+
+// ClientHistory -- журнал изменений клиента
+func (s *Server) ClientHistory(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
 		return
 	}
 
-	if err = market.ValidateForList(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if !s.authorize(w, r, auth.ResourceClients, auth.ActionHistory, database.Client{Id: &id}, nil) {
 		return
 	}
 
-	list, err := s.DB.GetList(market)
+	s.writeHistory(w, r, database.Client{Id: &id})
+}
+
+func (s *Server) MarketList(w http.ResponseWriter, r *http.Request) {
+	var filter database.MarketFilter
+	request, err := readListRequest(r, marketIntFields, marketBoolFields)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "get list error", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
-	response := make([]byte, 0)
-	for _, mdl := range list {
-		bytesModel, err := mdl.Marshal(s.logger)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "unable to marshal model", s.logger)
+	// сначала валидация: неверные типы в query string должны вернуть ошибку по полю
+	if err = filter.Validate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
+		return
+	}
+
+	if err = json.Unmarshal(request, &filter); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
+		return
+	}
+
+	owner, ok := s.authorizeList(w, r, auth.ResourceMarkets)
+	if !ok {
+		return
+	}
+	if owner != nil {
+		if filter.Owner != nil && *filter.Owner != *owner {
+			s.forbid(w, r, auth.Permission(auth.ResourceMarkets, auth.ActionRead))
 			return
 		}
-		response = append(response, bytesModel...)
+		filter.Owner = owner
 	}
 
-	w.Write(response)
+	page, err := s.DB.GetList(r.Context(), filter)
+	if err != nil {
+		s.writeStorageError(w, r, err, "get list error")
+		return
+	}
+
+	s.writeList(w, r, page)
+}
+
+func (s *Server) MarketGet(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	withDeleted, err := includeDeleted(r)
+	if err != nil {
+		s.writeRequestError(w, r, err)
+		return
+	}
+
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionRead, database.Market{Id: &id}, nil) {
+		return
+	}
+
+	found, err := s.DB.Get(r.Context(), database.Market{Id: &id})
+	if err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	market := found.(database.Market)
+	if market.DeletedAt != nil && !withDeleted {
+		s.writeStorageError(w, r, database.ErrNotFound, "get error")
+		return
+	}
+
+	s.writeModel(w, r, market, market.Version)
 }
 
 func (s *Server) MarketCreate(w http.ResponseWriter, r *http.Request) {
 	var market database.Market
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &market); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	if err = market.ValidateForCreate(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if err = market.ValidateForCreate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	id, err := s.DB.Insert(market)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "insert error", s.logger)
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionCreate, nil, market) {
 		return
 	}
 
-	response, err := json.Marshal(setResponseId(id))
+	id, err := s.DB.Insert(r.Context(), market)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeStorageError(w, r, err, "insert error")
 		return
 	}
 
-	w.Write(response)
+	w.Header().Set("Location", "/markets/"+id)
+	setETag(w, database.InitialVersion)
+	s.writeJSON(w, r, http.StatusCreated, setResponseId(id))
 }
 
 func (s *Server) MarketUpdate(w http.ResponseWriter, r *http.Request) {
 	var market database.Market
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &market); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
+		return
+	}
+
+	if err = market.ValidateForUpdate(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	if err = market.ValidateForUpdate(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionUpdate, database.Market{Id: market.Id}, market) {
 		return
 	}
 
-	err = s.DB.Update(market)
+	if market.Version, err = s.ifMatch(r, market); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Update(r.Context(), market)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "update error", s.logger)
+		s.writeStorageError(w, r, err, "update error")
+		return
+	}
+
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
+}
+
+func (s *Server) MarketPatch(w http.ResponseWriter, r *http.Request) {
+	var market database.Market
+	request, err := readRequest(r)
+	if err != nil {
+		s.writeRequestError(w, r, err)
+		return
+	}
+
+	// валидация до разбора: в PATCH важно отличать отсутствующее поле от null
+	if err = market.ValidateForPatch(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	response, err := json.Marshal(setStatus(success))
+	patch, err := market.ParsePatch(request)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	w.Write(response)
+	id := pathParam(r, "id")
+	market.Id = &id
+	// смена владельца проверяется так же, как владелец в PUT
+	var proposed database.Model
+	if owner, ok := patch["owner"]; ok {
+		changed := database.Market{}
+		if newOwner, ok := owner.(string); ok {
+			changed.Owner = &newOwner
+		}
+		proposed = changed
+	}
+
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionUpdate, database.Market{Id: &id}, proposed) {
+		return
+	}
+
+	if market.Version, err = s.ifMatch(r, market); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Patch(r.Context(), market, patch)
+	if err != nil {
+		s.writeStorageError(w, r, err, "patch error")
+		return
+	}
+
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
 }
 
 func (s *Server) MarketDelete(w http.ResponseWriter, r *http.Request) {
 	var market database.Market
-	request, err := io.ReadAll(r.Body)
+	request, err := readRequest(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "unable to read request body", s.logger)
+		s.writeRequestError(w, r, err)
 		return
 	}
 
 	if err = json.Unmarshal(request, &market); err != nil {
-		writeError(w, http.StatusBadRequest, "wrong json", s.logger)
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "wrong json")
 		return
 	}
 
-	if err = market.ValidateForDelete(request, s.logger); err != nil {
-		writeError(w, http.StatusBadRequest, "validation fail", s.logger)
+	if err = market.ValidateForDelete(request, s.log(r)); err != nil {
+		s.writeValidationError(w, r, err)
 		return
 	}
 
-	err = s.DB.Delete(market)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "delete error", s.logger)
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionDelete, database.Market{Id: market.Id}, nil) {
 		return
 	}
 
-	response, err := json.Marshal(setStatus(success))
+	if market.Version, err = s.ifMatch(r, market); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	err = s.DB.Delete(r.Context(), market)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to marshal response", s.logger)
+		s.writeStorageError(w, r, err, "delete error")
 		return
 	}
 
-	w.Write(response)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
 }
 
-func writeError(w http.ResponseWriter, status int, msg string, logger *logging.Logger) {
-	logger.Warningf("error: status-[%d]; msg-[%s]", status, msg)
-	w.Write([]byte(msg))
-	w.WriteHeader(status)
-}
+// MarketRestore снимает с магазина пометку удаления
+func (s *Server) MarketRestore(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	var err error
+	market := database.Market{Id: &id}
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionRestore, database.Market{Id: &id}, nil) {
+		return
+	}
 
-func setResponseId(id string) map[string]string {
-	responseMap := make(map[string]string)
-	responseMap["id"] = id
-	return responseMap
+	if market.Version, err = s.ifMatch(r, market); err != nil {
+		s.writeStorageError(w, r, err, "get error")
+		return
+	}
+
+	version, err := s.DB.Restore(r.Context(), market)
+	if err != nil {
+		s.writeStorageError(w, r, err, "restore error")
+		return
+	}
+
+	setETag(w, version)
+	s.writeJSON(w, r, http.StatusOK, setStatus(success))
 }
 
-func setStatus(status string) map[string]string {
-	responseMap := make(map[string]string)
-	responseMap["status"] = status
-	return responseMap
+// MarketHistory -- журнал изменений магазина
+func (s *Server) MarketHistory(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	if !validId(id) {
+		s.writeError(w, r, http.StatusBadRequest, codeInvalidId, "id should be a valid uuid")
+		return
+	}
+
+	if !s.authorize(w, r, auth.ResourceMarkets, auth.ActionHistory, database.Market{Id: &id}, nil) {
+		return
+	}
+
+	s.writeHistory(w, r, database.Market{Id: &id})
 }
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wb/rest-api/internal/auth"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/internal/storage/database"
+	"wb/rest-api/pkg/logging"
+	"wb/rest-api/pkg/metrics"
+)
+
+const (
+	testAPIKey    = "test-key"
+	supportAPIKey = "support-key"
+)
+
+// newTestServer -- сервер на хранилище в памяти: те же обработчики, что и с PostgreSQL
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newTestServerWith(t, config.Database{OnClientDelete: config.OnDeleteRestrict})
+}
+
+// newTestServerWith -- как newTestServer, но с настройками хранилища dbConfig
+func newTestServerWith(t *testing.T, dbConfig config.Database) *httptest.Server {
+	t.Helper()
+	logger := logging.GetLogger()
+
+	authCfg := config.Auth{
+		APIKeys: []config.APIKey{
+			{Name: "test", Key: testAPIKey, Roles: []string{"admin"}},
+			{Name: "support", Key: supportAPIKey, Roles: []string{"support"}},
+		},
+		Roles: map[string][]string{
+			"admin":   {"*"},
+			"support": {"clients:read", "markets:read"},
+		},
+	}
+	authenticator, err := auth.NewAuthenticator(authCfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := auth.NewPolicy(authCfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := metrics.NewRegistry()
+	storage := database.Instrument(database.NewMemoryStorage(dbConfig, logger), registry)
+
+	ts := httptest.NewServer(NewServer(storage, authenticator, policy, registry,
+		config.Server{MaxBodyBytes: 1 << 20, HealthTimeout: config.Duration{Duration: time.Second}}, logger))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do выполняет запрос с телом body в json (без тела, если nil) и возвращает статус и тело ответа
+func do(t *testing.T, ts *httptest.Server, method, path string, body interface{}) (int, []byte) {
+	t.Helper()
+
+	resp, respBody := doRequest(t, ts, method, path, body, nil)
+	return resp.StatusCode, respBody
+}
+
+// doRequest -- как do, но с заголовками header и ответом целиком. Запрос идет с тестовым ключом,
+// если header не задает свой
+func doRequest(t *testing.T, ts *httptest.Server, method, path string, body interface{},
+	header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(auth.HeaderAPIKey, testAPIKey)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, respBody
+}
+
+// decodeList разбирает конверт списка и проверяет, что count совпадает с числом элементов
+func decodeList(t *testing.T, body []byte) []map[string]interface{} {
+	t.Helper()
+
+	var list struct {
+		Items []map[string]interface{} `json:"items"`
+		Count int                      `json:"count"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatalf("unable to decode list %q: %v", body, err)
+	}
+	if list.Items == nil || list.Count != len(list.Items) {
+		t.Fatalf("unexpected list envelope %s", body)
+	}
+	return list.Items
+}
+
+func createdId(t *testing.T, status int, body []byte) string {
+	t.Helper()
+
+	var created struct {
+		Id string `json:"id"`
+	}
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	if err := json.Unmarshal(body, &created); err != nil || created.Id == "" {
+		t.Fatalf("create: unexpected body %s", body)
+	}
+	return created.Id
+}
+
+func TestClientLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+
+	client := map[string]interface{}{
+		"last_name":         "Sokolov",
+		"first_name":        "Petr",
+		"patronymic":        "Igorevich",
+		"age":               30,
+		"registration_date": "01-01-2012",
+	}
+	status, body := do(t, ts, http.MethodPost, "/clients", client)
+	id := createdId(t, status, body)
+
+	status, body = do(t, ts, http.MethodGet, "/clients?last_name=Sokolov", nil)
+	items := decodeList(t, body)
+	if status != http.StatusOK || len(items) != 1 || items[0]["id"] != id || items[0]["first_name"] != "Petr" {
+		t.Fatalf("list: status %d, items %v", status, items)
+	}
+
+	var got map[string]interface{}
+	status, body = do(t, ts, http.MethodGet, "/clients/"+id, nil)
+	if err := json.Unmarshal(body, &got); status != http.StatusOK || err != nil || got["last_name"] != "Sokolov" {
+		t.Fatalf("get: status %d, body %s", status, body)
+	}
+
+	client["first_name"] = "Pavel"
+	if status, body = do(t, ts, http.MethodPut, "/clients/"+id, client); status != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", status, body)
+	}
+
+	_, body = do(t, ts, http.MethodGet, "/clients?last_name=Sokolov", nil)
+	if items = decodeList(t, body); len(items) != 1 || items[0]["first_name"] != "Pavel" {
+		t.Fatalf("list after update: items %v", items)
+	}
+
+	if status, body = do(t, ts, http.MethodDelete, "/clients/"+id, nil); status != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", status, body)
+	}
+
+	if status, _ = do(t, ts, http.MethodGet, "/clients/"+id, nil); status != http.StatusNotFound {
+		t.Fatalf("get after delete: status %d, want 404", status)
+	}
+
+	_, body = do(t, ts, http.MethodGet, "/clients?last_name=Sokolov", nil)
+	if items = decodeList(t, body); len(items) != 0 {
+		t.Fatalf("list after delete: items %v", items)
+	}
+}
+
+func TestMarketLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+
+	market := map[string]interface{}{"name": "Magnit", "address": "Moscow", "active": true}
+	status, body := do(t, ts, http.MethodPost, "/markets", market)
+	id := createdId(t, status, body)
+
+	_, body = do(t, ts, http.MethodGet, "/markets?name=Magnit", nil)
+	if items := decodeList(t, body); len(items) != 1 || items[0]["id"] != id || items[0]["active"] != true {
+		t.Fatalf("list: items %v", items)
+	}
+
+	market["active"] = false
+	do(t, ts, http.MethodPut, "/markets/"+id, market)
+
+	_, body = do(t, ts, http.MethodGet, "/markets?name=Magnit", nil)
+	if items := decodeList(t, body); len(items) != 1 || items[0]["active"] != false {
+		t.Fatalf("list after update: items %v", items)
+	}
+
+	do(t, ts, http.MethodDelete, "/markets/"+id, nil)
+
+	_, body = do(t, ts, http.MethodGet, "/markets?name=Magnit", nil)
+	if items := decodeList(t, body); len(items) != 0 {
+		t.Fatalf("list after delete: items %v", items)
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// операции в журнале изменений
+const (
+	opCreate  = "create"
+	opUpdate  = "update"
+	opPatch   = "patch"
+	opDelete  = "delete"
+	opRestore = "restore"
+	opPurge   = "purge"
+)
+
+const (
+	insertAudit = "INSERT INTO audit_log (entity, entity_id, operation, before, after, request_id, caller) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	selectHistory = "SELECT id, entity, entity_id, operation, before, after, changed_at, request_id, caller " +
+		"FROM audit_log WHERE entity = $1 AND entity_id = $2 ORDER BY id"
+)
+
+// Actor -- запрос, от имени которого меняются данные
+type Actor struct {
+	RequestId string
+	Caller    string
+}
+
+type actorKey struct{}
+
+// WithActor сохраняет в контексте запрос, изменения которого попадут в журнал
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// AuditEntry -- запись журнала изменений: состояние записи до и после операции
+type AuditEntry struct {
+	Id        int64           `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityId  string          `json:"entity_id"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	ChangedAt time.Time       `json:"changed_at"`
+	RequestId string          `json:"request_id,omitempty"`
+	Caller    string          `json:"caller,omitempty"`
+}
+
+func newAuditEntry(ctx context.Context, operation string, before, after Model) (AuditEntry, error) {
+	actor := actorFrom(ctx)
+	entry := AuditEntry{
+		Operation: operation,
+		ChangedAt: time.Now(),
+		RequestId: actor.RequestId,
+		Caller:    actor.Caller,
+	}
+
+	for _, state := range []struct {
+		mdl  Model
+		dest *json.RawMessage
+	}{{before, &entry.Before}, {after, &entry.After}} {
+		if state.mdl == nil {
+			continue
+		}
+
+		data, err := json.Marshal(state.mdl)
+		if err != nil {
+			return AuditEntry{}, err
+		}
+		*state.dest = data
+		entry.Entity, entry.EntityId = state.mdl.table(), state.mdl.key()
+	}
+
+	return entry, nil
+}
+
+// audit записывает изменение в журнал в транзакции самого изменения
+func (db *Database) audit(ctx context.Context, tx *sql.Tx, operation string, before, after Model) error {
+	entry, err := newAuditEntry(ctx, operation, before, after)
+	if err != nil {
+		db.log(ctx).Warningf("failed to marshal audit entry: %v", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, insertAudit,
+		entry.Entity,
+		entry.EntityId,
+		entry.Operation,
+		nullJSON(entry.Before),
+		nullJSON(entry.After),
+		entry.RequestId,
+		entry.Caller)
+	if err != nil {
+		db.log(ctx).Warningf("failed to write audit entry: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// auditChange перечитывает измененную запись и записывает ее состояние до и после в журнал
+func (db *Database) auditChange(ctx context.Context, tx *sql.Tx, operation string, before, changed Model) error {
+	after, err := db.lockRow(ctx, tx, changed)
+	if err != nil {
+		return err
+	}
+
+	return db.audit(ctx, tx, operation, before, after)
+}
+
+// History возвращает журнал изменений записи от старых изменений к новым; ErrNotFound -- нет ни записи, ни журнала
+func (db *Database) History(ctx context.Context, mdl Model) ([]AuditEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Conn.QueryContext(ctx, selectHistory, mdl.table(), mdl.key())
+	if err != nil {
+		db.log(ctx).Warningf("failed to get history: %v", err)
+		return nil, wrapError(ctx, err)
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after, requestId, caller sql.NullString
+		err = rows.Scan(&entry.Id, &entry.Entity, &entry.EntityId, &entry.Operation,
+			&before, &after, &entry.ChangedAt, &requestId, &caller)
+		if err != nil {
+			db.log(ctx).Warningf("failed to scan audit entry: %v", err)
+			return nil, wrapError(ctx, err)
+		}
+
+		entry.Before, entry.After = rawJSON(before), rawJSON(after)
+		entry.RequestId, entry.Caller = requestId.String, caller.String
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		db.log(ctx).Warningf("failed to iterate audit entries: %v", err)
+		return nil, wrapError(ctx, err)
+	}
+
+	// записи без изменений в журнале (например, созданные до его появления) -- пустой список
+	if len(entries) == 0 {
+		if _, err = mdl.Get(ctx, db); err != nil {
+			return nil, wrapError(ctx, err)
+		}
+	}
+
+	return entries, nil
+}
+
+func nullJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func rawJSON(value sql.NullString) json.RawMessage {
+	if !value.Valid {
+		return nil
+	}
+	return json.RawMessage(value.String)
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestMemoryHistory(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage(config.Database{}, logging.GetLogger()).(*Memory)
+
+	id, err := storage.Insert(ctx, Client{LastName: "Sokolov", FirstName: "Petr", Patronymic: "Igorevich",
+		RegistrationDate: "01-01-2012"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err := storage.History(ctx, Client{Id: &id}); err != nil || len(entries) != 1 {
+		t.Fatalf("history: %v, err %v", entries, err)
+	}
+
+	// запись без изменений в журнале, как созданная до его появления
+	storage.history = nil
+	entries, err := storage.History(ctx, Client{Id: &id})
+	if err != nil || entries == nil || len(entries) != 0 {
+		t.Fatalf("history without entries: %v, err %v, want empty list", entries, err)
+	}
+
+	missing := "b2d14bbd-94d5-11ed-a690-3aca73727d74"
+	if _, err = storage.History(ctx, Client{Id: &missing}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("history of missing client: err %v, want %v", err, ErrNotFound)
+	}
+}
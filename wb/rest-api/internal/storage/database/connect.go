@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+// backoff -- экспоненциальная задержка между попытками со случайным разбросом,
+// чтобы несколько экземпляров сервиса не стучались в БД одновременно
+type backoff struct {
+	delay time.Duration
+	max   time.Duration
+}
+
+func newBackoff(retry config.ConnectRetry) *backoff {
+	return &backoff{delay: retry.InitialBackoff.Duration, max: retry.MaxBackoff.Duration}
+}
+
+// next возвращает случайную задержку от половины до полной текущей и удваивает текущую до max
+func (b *backoff) next() time.Duration {
+	delay := b.delay
+	if b.delay < b.max {
+		b.delay *= 2
+		if b.delay > b.max {
+			b.delay = b.max
+		}
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// waitForDB повторяет ping, пока БД не ответит. Если у ctx есть срок, попытки прекращаются,
+// когда следующая уже не успевает до него
+func waitForDB(ctx context.Context, conn *sql.DB, retry config.ConnectRetry, logger *logging.Logger) error {
+	wait := newBackoff(retry)
+	for attempt := 1; ; attempt++ {
+		err := conn.PingContext(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Infof("connected to db on attempt %d", attempt)
+			}
+			return nil
+		}
+
+		delay := wait.next()
+		deadline, ok := ctx.Deadline()
+		if ctx.Err() != nil || ok && time.Now().Add(delay).After(deadline) {
+			logger.Warningf("db connection attempt %d failed: %v, giving up", attempt, err)
+			return fmt.Errorf("ping error after %d attempts: %v", attempt, err)
+		}
+
+		logger.Warningf("db connection attempt %d failed: %v, retrying in %s", attempt, err, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ping error after %d attempts: %v", attempt, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// reconnect переподключается в фоне после запуска без БД; готовность видна в /readyz.
+// С requireLatestSchema версия схемы проверяется, пока не станет последней: до этого хранилище не готово
+func (db *Database) reconnect(ctx context.Context, dbConfig config.Database) {
+	if err := waitForDB(ctx, db.Conn, dbConfig.ConnectRetry, db.logger); err != nil {
+		return
+	}
+	db.logger.Info("db connection established")
+
+	if !dbConfig.RequireLatestSchema {
+		return
+	}
+
+	wait := newBackoff(dbConfig.ConnectRetry)
+	for {
+		err := checkSchema(db.Conn, db.logger)
+		if err == nil {
+			db.schemaPending.Store(false)
+			return
+		}
+
+		delay := wait.next()
+		db.logger.Warningf("db is not ready: %v, checking again in %s", err, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestReconnectRequireLatestSchema(t *testing.T) {
+	logger := logging.GetLogger()
+	conn := sql.OpenDB(&fakeConnector{})
+	defer conn.Close()
+
+	migrator, err := NewMigrator(conn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// как после запуска без БД: схема еще не проверена
+	db := &Database{Conn: conn, logger: logger, migrator: migrator}
+	db.schemaPending.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.reconnect(ctx, config.Database{
+			RequireLatestSchema: true,
+			ConnectRetry: config.ConnectRetry{
+				InitialBackoff: config.Duration{Duration: 10 * time.Millisecond},
+				MaxBackoff:     config.Duration{Duration: 20 * time.Millisecond},
+			},
+		})
+	}()
+
+	// БД доступна, но миграции не применены: хранилище не готово
+	time.Sleep(50 * time.Millisecond)
+	if err = db.checkMigrations(ctx); !errors.Is(err, errSchemaPending) {
+		t.Fatalf("before migrations: error = %v, want %v", err, errSchemaPending)
+	}
+
+	if err = migrator.To(ctx, migrator.Latest()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("reconnect did not finish after migrations were applied")
+	}
+	if err = db.checkMigrations(ctx); err != nil {
+		t.Fatalf("not ready after migrations are applied: %v", err)
+	}
+}
@@ -1,62 +1,455 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/lib/pq"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 	"wb/rest-api/internal/config"
 	"wb/rest-api/pkg/logging"
 )
 
 var _ Storage = &Database{}
 
+// InitialVersion -- версия только что созданной записи
+const InitialVersion = 1
+
 type Storage interface {
-	GetList(Model) ([]Model, error)
-	Insert(Model) (string, error)
-	Delete(Model) error
-	Update(Model) error
+	GetList(context.Context, Filter) (*Page, error)
+	Get(context.Context, Model) (Model, error)
+	Insert(context.Context, Model) (string, error)
+	Delete(context.Context, Model) error
+	Restore(context.Context, Model) (int, error)
+	Update(context.Context, Model) (int, error)
+	Patch(context.Context, Model, Patch) (int, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	History(context.Context, Model) ([]AuditEntry, error)
+	Checks() []Check
+	Close() error
 }
 
 type Database struct {
-	Conn   *sql.DB
-	logger *logging.Logger
+	Conn           *sql.DB
+	logger         *logging.Logger
+	migrator       *Migrator
+	timeout        time.Duration
+	onClientDelete string
+	// запуск без БД с requireLatestSchema: пока версия схемы не проверена, хранилище не готово
+	schemaPending atomic.Bool
+}
+
+// NewDatabaseConnection ждет БД до connectRetry.deadline. С connectRetry.startDegraded недоступная БД
+// не мешает запуску: хранилище возвращается сразу и переподключается в фоне до отмены ctx
+func NewDatabaseConnection(ctx context.Context, dbConfig config.Database, logger *logging.Logger) (Storage, error) {
+	conn, err := openPool(dbConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		Conn:           conn,
+		logger:         logger,
+		timeout:        dbConfig.QueryTimeout.Duration,
+		onClientDelete: dbConfig.OnClientDelete,
+	}
+
+	db.migrator, err = NewMigrator(conn, logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err = connect(ctx, conn, dbConfig, logger); err != nil {
+		if !dbConfig.ConnectRetry.StartDegraded || ctx.Err() != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		logger.Warningf("starting without db, reconnecting in background: %v", err)
+		db.schemaPending.Store(dbConfig.RequireLatestSchema)
+		go db.reconnect(ctx, dbConfig)
+		return db, nil
+	}
+
+	if dbConfig.RequireLatestSchema {
+		if err = checkSchema(conn, logger); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// Open открывает пул соединений и ждет доступности БД до connectRetry.deadline
+func Open(ctx context.Context, dbConfig config.Database, logger *logging.Logger) (*sql.DB, error) {
+	conn, err := openPool(dbConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = connect(ctx, conn, dbConfig, logger); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
 }
 
-func NewDatabaseConnection(dbConfig config.Database, logger *logging.Logger) (Storage, error) {
-	logger.Info("new db connection:", dbConfig)
+// connect ждет, пока БД ответит на ping, не дольше connectRetry.deadline
+func connect(ctx context.Context, conn *sql.DB, dbConfig config.Database, logger *logging.Logger) error {
+	retry := dbConfig.ConnectRetry
+	if retry.Deadline.Duration <= 0 {
+		if err := conn.PingContext(ctx); err != nil {
+			logger.Warningf("failed to ping db: %v", err)
+			return fmt.Errorf("ping error: %v", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, retry.Deadline.Duration)
+	defer cancel()
 
-	dataSourceName := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s",
-		dbConfig.User, dbConfig.Password, dbConfig.DBName, dbConfig.SSLMode)
+	return waitForDB(ctx, conn, retry, logger)
+}
 
-	db, err := sql.Open("postgres", dataSourceName)
+// openPool создает пул соединений; сами соединения открываются при первом запросе
+func openPool(dbConfig config.Database, logger *logging.Logger) (*sql.DB, error) {
+	logger.Infof("new db connection: %s", describe(dbConfig))
+
+	db, err := sql.Open("postgres", dataSourceName(dbConfig))
 	if err != nil {
 		logger.Warningf("failed to open sql: %v", err)
 		return nil, fmt.Errorf("open sql error: %v", err)
 	}
 
-	if err = db.Ping(); err != nil {
-		logger.Warningf("failed to ping db: %v", err)
-		return nil, fmt.Errorf("ping error: %v", err)
+	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	if dbConfig.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(dbConfig.ConnMaxLifetime.Duration)
+	db.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime.Duration)
+
+	return db, nil
+}
+
+// dataSourceName собирает строку подключения lib/pq из заданных параметров, если DSN не задан целиком
+func dataSourceName(dbConfig config.Database) string {
+	if dbConfig.DSN != "" {
+		return dbConfig.DSN
+	}
+
+	params := []struct{ key, value string }{
+		{"host", dbConfig.Host},
+		{"port", dbConfig.Port},
+		{"user", dbConfig.User},
+		{"password", dbConfig.Password},
+		{"dbname", dbConfig.DBName},
+		{"sslmode", dbConfig.SSLMode},
+		{"sslrootcert", dbConfig.SSLRootCert},
+		{"sslcert", dbConfig.SSLCert},
+		{"sslkey", dbConfig.SSLKey},
+		{"application_name", dbConfig.ApplicationName},
+	}
+	if timeout := dbConfig.ConnectTimeout.Duration; timeout > 0 {
+		// lib/pq принимает целые секунды
+		seconds := int(math.Ceil(timeout.Seconds()))
+		params = append(params, struct{ key, value string }{"connect_timeout", strconv.Itoa(seconds)})
+	}
+
+	pairs := make([]string, 0, len(params))
+	for _, param := range params {
+		if param.value != "" {
+			pairs = append(pairs, param.key+"="+quoteParam(param.value))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+var paramEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quoteParam экранирует значение, чтобы пробелы и кавычки в пароле не ломали строку подключения
+func quoteParam(value string) string {
+	return "'" + paramEscaper.Replace(value) + "'"
+}
+
+// describe -- куда подключаемся, без пароля: для лога
+func describe(dbConfig config.Database) string {
+	if dbConfig.DSN != "" {
+		return "dsn from config"
+	}
+
+	host, port := dbConfig.Host, dbConfig.Port
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "5432"
+	}
+	return fmt.Sprintf("%s@%s:%s/%s", dbConfig.User, host, port, dbConfig.DBName)
+}
+
+// checkSchema не дает запуститься с БД, на которую не применены все миграции
+func checkSchema(db *sql.DB, logger *logging.Logger) error {
+	migrator, err := NewMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	current, err := migrator.Applied(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to get schema version: %v", err)
+	}
+
+	if current < migrator.Latest() {
+		logger.Warningf("schema version %d is behind %d", current, migrator.Latest())
+		return fmt.Errorf("schema version %d is behind %d, run \"migrate up\"", current, migrator.Latest())
+	}
+
+	logger.Infof("schema version: %d", current)
+	return nil
+}
+
+// withTimeout ограничивает время выполнения одной операции, если в конфиге задан queryTimeout
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.timeout)
+}
+
+func (db *Database) GetList(ctx context.Context, filter Filter) (*Page, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	page, err := filter.GetList(ctx, db)
+	return page, wrapError(ctx, err)
+}
+
+func (db *Database) Get(ctx context.Context, mdl Model) (Model, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	found, err := mdl.Get(ctx, db)
+	return found, wrapError(ctx, err)
+}
+
+func (db *Database) Insert(ctx context.Context, mdl Model) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	id, err := mdl.Insert(ctx, db)
+	return id, wrapError(ctx, err)
+}
+
+func (db *Database) Update(ctx context.Context, mdl Model) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	version, err := mdl.Update(ctx, db)
+	return version, wrapError(ctx, err)
+}
+
+func (db *Database) Patch(ctx context.Context, mdl Model, patch Patch) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	version, err := mdl.Patch(ctx, db, patch)
+	return version, wrapError(ctx, err)
+}
+
+func (db *Database) Delete(ctx context.Context, mdl Model) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return wrapError(ctx, mdl.Delete(ctx, db))
+}
+
+func (db *Database) Restore(ctx context.Context, mdl Model) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	version, err := mdl.Restore(ctx, db)
+	return version, wrapError(ctx, err)
+}
+
+// Purge окончательно удаляет записи, помеченные удаленными раньше deletedBefore.
+// Клиенты, на которых еще ссылаются магазины, остаются до удаления этих магазинов
+func (db *Database) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	purged := 0
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range []struct {
+			query string
+			scan  func(scanner) (Model, error)
+		}{{purgeMarkets, marketRow}, {purgeClients, clientRow}} {
+			deleted, err := db.lockRows(ctx, tx, table.query, table.scan, deletedBefore)
+			if err != nil {
+				return err
+			}
+
+			for _, mdl := range deleted {
+				if err = db.audit(ctx, tx, opPurge, mdl, nil); err != nil {
+					return err
+				}
+			}
+			purged += len(deleted)
+		}
+		return nil
+	})
+
+	return purged, wrapError(ctx, err)
+}
+
+// log возвращает логгер запроса с его id и вызывающим, а вне запроса -- логгер хранилища
+func (db *Database) log(ctx context.Context) *logging.Logger {
+	return logging.FromContext(ctx, db.logger)
+}
+
+// inTx выполняет fn в транзакции; транзакция откатывается, если fn вернула ошибку
+func (db *Database) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		db.log(ctx).Warningf("failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		db.log(ctx).Warningf("failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// checkOwner проверяет, что владелец магазина, если он задан, существует и не удален,
+// и блокирует его от удаления до конца транзакции
+func (db *Database) checkOwner(ctx context.Context, tx *sql.Tx, owner *string) error {
+	if owner == nil {
+		return nil
+	}
+
+	var found int
+	err := tx.QueryRowContext(ctx, lockOwner, owner).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOwnerNotFound
+	}
+	if err != nil {
+		db.log(ctx).Warningf("failed to check market owner: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// lockRow читает запись и блокирует ее до конца транзакции
+func (db *Database) lockRow(ctx context.Context, tx *sql.Tx, mdl Model) (Model, error) {
+	query, scan := lockClient, clientRow
+	if _, ok := mdl.(Market); ok {
+		query, scan = lockMarket, marketRow
+	}
+
+	found, err := scan(tx.QueryRowContext(ctx, query, mdl.key()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		db.log(ctx).Warningf("failed to lock %s: %v", mdl.table(), err)
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// current блокирует неудаленную запись, проверяя ожидаемую версию, если она задана
+func (db *Database) current(ctx context.Context, tx *sql.Tx, mdl Model) (Model, error) {
+	stored, err := db.lockRow(ctx, tx, mdl)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.deletedAt() != nil {
+		return nil, ErrNotFound
+	}
+	if expected := mdl.version(); expected != nil && *expected != *stored.version() {
+		return nil, ErrVersionMismatch
+	}
+
+	return stored, nil
+}
+
+// lockDeleted блокирует удаленную запись, проверяя ожидаемую версию, если она задана
+func (db *Database) lockDeleted(ctx context.Context, tx *sql.Tx, mdl Model) (Model, error) {
+	stored, err := db.lockRow(ctx, tx, mdl)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Database{
-		Conn:   db,
-		logger: logger,
-	}, nil
+	if stored.deletedAt() == nil {
+		return nil, ErrNotDeleted
+	}
+	if expected := mdl.version(); expected != nil && *expected != *stored.version() {
+		return nil, ErrVersionMismatch
+	}
+
+	return stored, nil
 }
 
-func (db *Database) GetList(mdl Model) ([]Model, error) {
-	return mdl.GetList(db)
+// lockRows читает все записи запроса; строки закрываются до следующих запросов в транзакции
+func (db *Database) lockRows(ctx context.Context, tx *sql.Tx, query string, scan func(scanner) (Model, error),
+	args ...interface{}) ([]Model, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		db.log(ctx).Warningf("failed to select rows: %v", err)
+		return nil, err
+	}
+
+	return db.scanRows(ctx, rows, scan)
+}
+
+func (db *Database) scanRows(ctx context.Context, rows *sql.Rows,
+	scan func(scanner) (Model, error)) ([]Model, error) {
+	defer rows.Close()
+
+	result := make([]Model, 0)
+	for rows.Next() {
+		mdl, err := scan(rows)
+		if err != nil {
+			db.log(ctx).Warningf("failed to scan row: %v", err)
+			return nil, err
+		}
+		result = append(result, mdl)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log(ctx).Warningf("failed to iterate rows: %v", err)
+		return nil, err
+	}
+
+	return result, nil
 }
 
-func (db *Database) Insert(mdl Model) (string, error) {
-	return mdl.Insert(db)
+func clientRow(row scanner) (Model, error) {
+	return scanClient(row)
 }
 
-func (db *Database) Update(mdl Model) error {
-	return mdl.Update(db)
+func marketRow(row scanner) (Model, error) {
+	return scanMarket(row)
 }
 
-func (db *Database) Delete(mdl Model) error {
-	return mdl.Delete(db)
+func (db *Database) Close() error {
+	return db.Conn.Close()
 }
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"testing"
+	"time"
+	"wb/rest-api/internal/config"
+
+	"github.com/lib/pq"
+)
+
+func TestQuoteParam(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"secret", `'secret'`},
+		{"", `''`},
+		{"pass word", `'pass word'`},
+		{"it's", `'it\'s'`},
+		{`back\slash`, `'back\\slash'`},
+		{`\'`, `'\\\''`},
+		{"key=value", `'key=value'`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteParam(tt.value); got != tt.want {
+			t.Errorf("quoteParam(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbConfig config.Database
+		want     string
+	}{
+		{"dsn as is", config.Database{DSN: "postgres://user@db/wbdb"}, "postgres://user@db/wbdb"},
+		{"parameters", config.Database{User: "postgres", Password: "pass", DBName: "wbdb", SSLMode: "disable"},
+			`user='postgres' password='pass' dbname='wbdb' sslmode='disable'`},
+		{"host and tls", config.Database{Host: "db", Port: "6432", User: "app", SSLMode: "verify-full",
+			SSLRootCert: "/certs/ca.pem", ApplicationName: "rest-api"},
+			`host='db' port='6432' user='app' sslmode='verify-full' sslrootcert='/certs/ca.pem' application_name='rest-api'`},
+		// lib/pq принимает целые секунды, доли округляются вверх
+		{"connect timeout", config.Database{User: "app", ConnectTimeout: config.Duration{Duration: 1500 * time.Millisecond}},
+			`user='app' connect_timeout='2'`},
+		{"quoted password", config.Database{User: "app", Password: `p'a ss\`},
+			`user='app' password='p\'a ss\\'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := dataSourceName(tt.dbConfig)
+			if dsn != tt.want {
+				t.Fatalf("dsn = %s, want %s", dsn, tt.want)
+			}
+			// строку должен разобрать сам драйвер
+			if _, err := pq.NewConnector(dsn); err != nil {
+				t.Fatalf("lib/pq rejects dsn %s: %v", dsn, err)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if got := describe(config.Database{User: "app", Password: "secret", DBName: "wbdb"}); got != "app@localhost:5432/wbdb" {
+		t.Errorf("describe = %s", got)
+	}
+	if got := describe(config.Database{DSN: "postgres://app:secret@db/wbdb"}); got != "dsn from config" {
+		t.Errorf("describe dsn = %s", got)
+	}
+}
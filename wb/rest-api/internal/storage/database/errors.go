@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrQueryTimeout  = errors.New("query timeout")
+	ErrQueryCanceled = errors.New("query canceled")
+
+	ErrInvalidPageToken = errors.New("invalid page token")
+
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrUnavailable  = errors.New("storage unavailable")
+
+	ErrVersionMismatch = errors.New("version mismatch")
+
+	ErrOwnerNotFound   = fmt.Errorf("%w: owner client not found", ErrInvalidInput)
+	ErrOwnerHasMarkets = fmt.Errorf("%w: client owns markets", ErrConflict)
+	ErrNotDeleted      = fmt.Errorf("%w: record is not deleted", ErrConflict)
+)
+
+// contextError заменяет ошибку драйвера на ErrQueryTimeout/ErrQueryCanceled,
+// если запрос прервался из-за контекста
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w: %v", ErrQueryCanceled, err)
+	}
+
+	return err
+}
+
+// wrapError приводит ошибки postgres и драйвера к ошибкам пакета,
+// чтобы сервер мог выбрать статус ответа, не зная о конкретной БД
+func wrapError(ctx context.Context, err error) error {
+	err = contextError(ctx, err)
+	if err == nil || errors.Is(err, ErrQueryTimeout) || errors.Is(err, ErrQueryCanceled) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505", pqErr.Code == "23503", pqErr.Code == "40001":
+			// unique_violation, foreign_key_violation, serialization_failure
+			return fmt.Errorf("%w: %v", ErrConflict, err)
+		case pqErr.Code.Class() == "22", pqErr.Code == "23502", pqErr.Code == "23514":
+			// data_exception, not_null_violation, check_violation
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57":
+			// connection_exception, insufficient_resources, operator_intervention
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		strings.Contains(err.Error(), "connection refused") {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	return err
+}
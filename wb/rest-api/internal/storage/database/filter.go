@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ Filter = ClientFilter{}
+var _ Filter = MarketFilter{}
+
+const (
+	dateLayout         = "02-01-2006"
+	sortableDateLayout = "2006-01-02"
+
+	// дата регистрации или NULL, если она записана не в формате DD-MM-YYYY (как sortableDate)
+	registrationDate = "registration_date_value(registration_date)"
+)
+
+// выражения сортировки должны совпадать с sortValue моделей
+var clientSortColumns = map[string]string{
+	"id":                "id::text",
+	"last_name":         "COALESCE(last_name, '')",
+	"first_name":        "COALESCE(first_name, '')",
+	"patronymic":        "COALESCE(patronymic, '')",
+	"age":               "lpad(COALESCE(age, 0)::text, 3, '0')",
+	"registration_date": "COALESCE(to_char(" + registrationDate + ", 'YYYY-MM-DD'), '')",
+}
+
+var marketSortColumns = map[string]string{
+	"id":      "id::text",
+	"name":    "COALESCE(name, '')",
+	"address": "COALESCE(address, '')",
+	"active":  "CASE WHEN active THEN '1' ELSE '0' END",
+	"owner":   "COALESCE(owner::text, '')",
+}
+
+const (
+	clientColumns = "id, last_name, first_name, patronymic, age, registration_date, version, deleted_at"
+	marketColumns = "id, name, address, active, owner, version, deleted_at"
+
+	selectClients = "SELECT " + clientColumns + " FROM clients"
+	selectMarkets = "SELECT " + marketColumns + " FROM markets"
+)
+
+type ClientFilter struct {
+	// Id ограничивает список одним клиентом; задается сервером, а не параметрами запроса
+	Id                   *string `json:"-"`
+	LastName             *string `json:"last_name,omitempty"`
+	FirstName            *string `json:"first_name,omitempty"`
+	Patronymic           *string `json:"patronymic,omitempty"`
+	AgeFrom              *int    `json:"age_from,omitempty"`
+	AgeTo                *int    `json:"age_to,omitempty"`
+	RegistrationDateFrom *string `json:"registration_date_from,omitempty"`
+	RegistrationDateTo   *string `json:"registration_date_to,omitempty"`
+	ListOptions
+}
+
+func (f ClientFilter) table() string {
+	return Client{}.table()
+}
+
+func (f ClientFilter) options() ListOptions {
+	return f.ListOptions.withDefaults("last_name")
+}
+
+func (f ClientFilter) GetList(ctx context.Context, db *Database) (*Page, error) {
+	opts := f.options()
+	cursor, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &listQuery{}
+	if !opts.IncludeDeleted {
+		q.where("deleted_at IS NULL")
+	}
+	if f.Id != nil {
+		q.where("id = " + q.arg(*f.Id))
+	}
+	if f.LastName != nil {
+		q.where("last_name = " + q.arg(*f.LastName))
+	}
+	if f.FirstName != nil {
+		q.where("first_name = " + q.arg(*f.FirstName))
+	}
+	if f.Patronymic != nil {
+		q.where("patronymic = " + q.arg(*f.Patronymic))
+	}
+	if f.AgeFrom != nil {
+		q.where("age >= " + q.arg(*f.AgeFrom))
+	}
+	if f.AgeTo != nil {
+		q.where("age <= " + q.arg(*f.AgeTo))
+	}
+	if f.RegistrationDateFrom != nil {
+		q.where(fmt.Sprintf("%s >= to_date(%s, 'DD-MM-YYYY')", registrationDate, q.arg(*f.RegistrationDateFrom)))
+	}
+	if f.RegistrationDateTo != nil {
+		q.where(fmt.Sprintf("%s <= to_date(%s, 'DD-MM-YYYY')", registrationDate, q.arg(*f.RegistrationDateTo)))
+	}
+
+	query := q.build(selectClients, clientSortColumns[opts.SortBy], opts, cursor)
+
+	return db.selectPage(ctx, query, q, opts, clientRow)
+}
+
+func (f ClientFilter) matches(stored Model) bool {
+	client, ok := stored.(Client)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case f.Id != nil && client.key() != *f.Id:
+		return false
+	case f.LastName != nil && client.LastName != *f.LastName:
+		return false
+	case f.FirstName != nil && client.FirstName != *f.FirstName:
+		return false
+	case f.Patronymic != nil && client.Patronymic != *f.Patronymic:
+		return false
+	case f.AgeFrom != nil && (client.Age == nil || *client.Age < *f.AgeFrom):
+		return false
+	case f.AgeTo != nil && (client.Age == nil || *client.Age > *f.AgeTo):
+		return false
+	}
+
+	registered := sortableDate(client.RegistrationDate)
+	if f.RegistrationDateFrom != nil && (registered == "" || registered < sortableDate(*f.RegistrationDateFrom)) {
+		return false
+	}
+	if f.RegistrationDateTo != nil && (registered == "" || registered > sortableDate(*f.RegistrationDateTo)) {
+		return false
+	}
+
+	return true
+}
+
+type MarketFilter struct {
+	Name    *string `json:"name,omitempty"`
+	Address *string `json:"address,omitempty"`
+	Active  *bool   `json:"active,omitempty"`
+	Owner   *string `json:"owner,omitempty"`
+	ListOptions
+}
+
+func (f MarketFilter) table() string {
+	return Market{}.table()
+}
+
+func (f MarketFilter) options() ListOptions {
+	return f.ListOptions.withDefaults("name")
+}
+
+func (f MarketFilter) GetList(ctx context.Context, db *Database) (*Page, error) {
+	opts := f.options()
+	cursor, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &listQuery{}
+	if !opts.IncludeDeleted {
+		q.where("deleted_at IS NULL")
+	}
+	if f.Name != nil {
+		q.where("name = " + q.arg(*f.Name))
+	}
+	if f.Address != nil {
+		q.where("address ILIKE " + q.arg(likePattern(*f.Address)))
+	}
+	if f.Active != nil {
+		q.where("active = " + q.arg(*f.Active))
+	}
+	if f.Owner != nil {
+		q.where("owner = " + q.arg(*f.Owner))
+	}
+
+	query := q.build(selectMarkets, marketSortColumns[opts.SortBy], opts, cursor)
+
+	return db.selectPage(ctx, query, q, opts, marketRow)
+}
+
+func (f MarketFilter) matches(stored Model) bool {
+	market, ok := stored.(Market)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case f.Name != nil && market.Name != *f.Name:
+		return false
+	case f.Address != nil && !strings.Contains(strings.ToLower(market.Address), strings.ToLower(*f.Address)):
+		return false
+	case f.Active != nil && market.Active != *f.Active:
+		return false
+	case f.Owner != nil && (market.Owner == nil || *market.Owner != *f.Owner):
+		return false
+	}
+
+	return true
+}
+
+// sortableDate переводит дату из формата "DD-MM-YYYY" в "YYYY-MM-DD", чтобы ее можно было сравнивать как строку
+func sortableDate(date string) string {
+	t, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return ""
+	}
+	return t.Format(sortableDateLayout)
+}
+
+func sortKeys[V any](columns map[string]V) []string {
+	keys := make([]string, 0, len(columns))
+	for key := range columns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+// testDSNEnv -- строка подключения к пустой тестовой БД, например
+// TEST_DATABASE_DSN="user=postgres dbname=wbtest sslmode=disable" go test ./...
+// Схема в ней пересоздается; без переменной тесты с PostgreSQL пропускаются
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// схема пересоздается встроенными миграциями: откат всех и применение заново
+	migrator, err := NewMigrator(conn, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.To(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Database{Conn: conn, logger: logging.GetLogger()}
+}
+
+// seed записывает модели в PostgreSQL и кладет их в память под теми же id
+func seed(t *testing.T, db *Database, memory *Memory, models ...Model) []string {
+	t.Helper()
+
+	ids := make([]string, 0, len(models))
+	for _, mdl := range models {
+		id, err := db.Insert(context.Background(), mdl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, ok := memory.tables[mdl.table()]
+		if !ok {
+			rows = make(map[string]Model)
+			memory.tables[mdl.table()] = rows
+		}
+		rows[id] = mdl.withId(id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// collect проходит все страницы списка и возвращает id в порядке выдачи и total
+func collect(t *testing.T, storage Storage, filter func(pageToken string) Filter) ([]string, int) {
+	t.Helper()
+
+	ids := make([]string, 0)
+	token := ""
+	for {
+		page, err := storage.GetList(context.Background(), filter(token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mdl := range page.Items {
+			ids = append(ids, mdl.key())
+		}
+		if page.NextPageToken == "" {
+			return ids, page.Total
+		}
+		token = page.NextPageToken
+	}
+}
+
+func intPtr(v int) *int               { return &v }
+func strPtr(v string) *string         { return &v }
+func boolPtr(v bool) *bool            { return &v }
+func pageOf(token string) ListOptions { return ListOptions{Limit: 2, PageToken: token} }
+
+// sortValue в памяти повторяет выражения сортировки SQL вручную, поэтому оба хранилища
+// должны отбирать и упорядочивать одни и те же записи одинаково, включая ничьи, регистр и не-ASCII
+func TestMemoryMatchesDatabase(t *testing.T) {
+	db := openTestDatabase(t)
+	memory := NewMemoryStorage(config.Database{}, logging.GetLogger()).(*Memory)
+
+	owners := seed(t, db, memory,
+		Client{LastName: "Ivanov", FirstName: "Anna", Patronymic: "Petrovna", Age: intPtr(30), RegistrationDate: "15-03-2015"},
+		Client{LastName: "ivanov", FirstName: "Boris", Patronymic: "Petrovich", Age: intPtr(5), RegistrationDate: "01-12-2009"},
+		Client{LastName: "Ivanov", FirstName: "Anna", Patronymic: "Petrovna", Age: intPtr(30), RegistrationDate: "15-03-2015"},
+		Client{LastName: "Ёлкин", FirstName: "Zoe", Patronymic: "Ivanovna", RegistrationDate: "31-01-2020"},
+		Client{LastName: "Abel", FirstName: "Émile", Patronymic: "Ivanovich", Age: intPtr(100), RegistrationDate: "29-02-2016"},
+	)
+	// записи, сохраненные до проверки формата даты: в сортировке они как пустая дата, в фильтры по дате не попадают
+	seed(t, db, memory,
+		Client{LastName: "Legacy", FirstName: "Slash", Patronymic: "Ivanovich", RegistrationDate: "2020/01/01"},
+		Client{LastName: "Legacy", FirstName: "Overflow", Patronymic: "Ivanovich", RegistrationDate: "31-02-2020"},
+		Client{LastName: "Legacy", FirstName: "Short", Patronymic: "Ivanovich", RegistrationDate: "1-1-2020"},
+	)
+	seed(t, db, memory,
+		Market{Name: "Magnit", Address: "Moscow, Tverskaya 1", Active: true, Owner: &owners[0]},
+		Market{Name: "magnit", Address: "MOSCOW", Active: false},
+		Market{Name: "Пятёрочка", Address: "Москва", Active: true, Owner: &owners[1]},
+		Market{Name: "Azbuka", Address: "St. Petersburg 50%", Active: false, Owner: &owners[0]},
+	)
+
+	type testCase struct {
+		name   string
+		filter func(pageToken string) Filter
+	}
+	tests := []testCase{
+		{"clients age from", func(token string) Filter {
+			return ClientFilter{AgeFrom: intPtr(10), ListOptions: pageOf(token)}
+		}},
+		{"clients age to", func(token string) Filter {
+			return ClientFilter{AgeTo: intPtr(30), ListOptions: pageOf(token)}
+		}},
+		{"clients registration range", func(token string) Filter {
+			return ClientFilter{RegistrationDateFrom: strPtr("01-01-2010"), RegistrationDateTo: strPtr("29-02-2016"),
+				ListOptions: pageOf(token)}
+		}},
+		{"clients registration from", func(token string) Filter {
+			return ClientFilter{RegistrationDateFrom: strPtr("01-01-2000"), ListOptions: pageOf(token)}
+		}},
+		{"clients first name", func(token string) Filter {
+			return ClientFilter{FirstName: strPtr("Anna"), ListOptions: pageOf(token)}
+		}},
+		{"markets address substring", func(token string) Filter {
+			return MarketFilter{Address: strPtr("moscow"), ListOptions: pageOf(token)}
+		}},
+		{"markets address with wildcard", func(token string) Filter {
+			return MarketFilter{Address: strPtr("50%"), ListOptions: pageOf(token)}
+		}},
+		{"markets inactive", func(token string) Filter {
+			return MarketFilter{Active: boolPtr(false), ListOptions: pageOf(token)}
+		}},
+		{"markets owner", func(token string) Filter {
+			return MarketFilter{Owner: &owners[0], ListOptions: pageOf(token)}
+		}},
+	}
+
+	for _, order := range []string{OrderAsc, OrderDesc} {
+		for _, sortBy := range sortKeys(clientSortColumns) {
+			opts := ListOptions{SortBy: sortBy, Order: order, Limit: 2}
+			tests = append(tests, testCase{"clients by " + sortBy + " " + order, func(token string) Filter {
+				opts.PageToken = token
+				return ClientFilter{ListOptions: opts}
+			}})
+		}
+		for _, sortBy := range sortKeys(marketSortColumns) {
+			opts := ListOptions{SortBy: sortBy, Order: order, Limit: 2}
+			tests = append(tests, testCase{"markets by " + sortBy + " " + order, func(token string) Filter {
+				opts.PageToken = token
+				return MarketFilter{ListOptions: opts}
+			}})
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantTotal := collect(t, db, tt.filter)
+			got, gotTotal := collect(t, memory, tt.filter)
+
+			if !reflect.DeepEqual(got, want) || gotTotal != wantTotal {
+				t.Fatalf("memory: %v (total %d), postgres: %v (total %d)", got, gotTotal, want, wantTotal)
+			}
+			if len(want) != wantTotal {
+				t.Fatalf("collected %d records, total %d", len(want), wantTotal)
+			}
+		})
+	}
+}
+
+// sortableDate задает, как хранилище в памяти понимает дату; registration_date_value в SQL должна совпадать с ней
+func TestSortableDate(t *testing.T) {
+	tests := []struct {
+		date string
+		want string
+	}{
+		{"15-03-2015", "2015-03-15"},
+		{"29-02-2016", "2016-02-29"},
+		{"29-02-2015", ""},
+		{"31-02-2020", ""},
+		{"2020/01/01", ""},
+		{"2020-01-01", ""},
+		{"1-1-2020", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := sortableDate(tt.date); got != tt.want {
+			t.Errorf("sortableDate(%q) = %q, want %q", tt.date, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errSchemaPending = errors.New("schema version is not checked since start without db")
+
+// Check -- проверка готовности хранилища обслуживать запросы
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+// Checks -- БД отвечает и на нее применены все миграции
+func (db *Database) Checks() []Check {
+	return []Check{
+		{Name: "database", Run: db.ping},
+		{Name: "migrations", Run: db.checkMigrations},
+	}
+}
+
+func (db *Database) ping(ctx context.Context) error {
+	if err := db.Conn.PingContext(ctx); err != nil {
+		db.log(ctx).Warningf("failed to ping db: %v", err)
+		return wrapError(ctx, err)
+	}
+	return nil
+}
+
+func (db *Database) checkMigrations(ctx context.Context) error {
+	if db.schemaPending.Load() {
+		return errSchemaPending
+	}
+
+	current, err := db.migrator.Applied(ctx)
+	if err != nil {
+		return wrapError(ctx, err)
+	}
+
+	if current < db.migrator.Latest() {
+		return fmt.Errorf("schema version %d is behind %d", current, db.migrator.Latest())
+	}
+	return nil
+}
+
+// Checks -- хранилищу в памяти нечего проверять
+func (m *Memory) Checks() []Check {
+	return nil
+}
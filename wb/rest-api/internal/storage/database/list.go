@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultLimit = 50
+	MaxLimit     = 500
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// Filter -- запрос списка моделей: условия отбора, сортировка и пагинация
+type Filter interface {
+	GetList(context.Context, *Database) (*Page, error)
+
+	// для хранилища в памяти
+	table() string
+	matches(Model) bool
+	options() ListOptions
+}
+
+type ListOptions struct {
+	SortBy    string `json:"sort_by,omitempty"`
+	Order     string `json:"order,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	PageToken string `json:"page_token,omitempty"`
+
+	// удаленные записи по умолчанию не попадают в список
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
+}
+
+type Page struct {
+	Items         []Model
+	NextPageToken string
+	// Total -- сколько всего записей подходит под фильтр, на всех страницах
+	Total int
+}
+
+// pageToken -- курсор на последнюю запись страницы.
+// Сортировка и направление сохраняются, чтобы токен нельзя было применить к другому запросу
+type pageToken struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	Id     string `json:"id"`
+}
+
+func (opts ListOptions) withDefaults(defaultSort string) ListOptions {
+	if opts.SortBy == "" {
+		opts.SortBy = defaultSort
+	}
+	if opts.Order == "" {
+		opts.Order = OrderAsc
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultLimit
+	}
+	if opts.Limit > MaxLimit {
+		opts.Limit = MaxLimit
+	}
+	return opts
+}
+
+func (opts ListOptions) cursor() (*pageToken, error) {
+	if opts.PageToken == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(opts.PageToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+
+	token := &pageToken{}
+	if err = json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+
+	if token.SortBy != opts.SortBy || token.Order != opts.Order {
+		return nil, fmt.Errorf("%w: token was issued for another sort order", ErrInvalidPageToken)
+	}
+
+	return token, nil
+}
+
+// newPage получает на одну запись больше лимита, чтобы понять, есть ли следующая страница
+func newPage(items []Model, opts ListOptions) *Page {
+	page := &Page{Items: items}
+	if len(items) <= opts.Limit {
+		return page
+	}
+
+	page.Items = items[:opts.Limit]
+	last := page.Items[len(page.Items)-1]
+
+	data, _ := json.Marshal(pageToken{
+		SortBy: opts.SortBy,
+		Order:  opts.Order,
+		Value:  last.sortValue(opts.SortBy),
+		Id:     last.key(),
+	})
+	page.NextPageToken = base64.RawURLEncoding.EncodeToString(data)
+
+	return page
+}
+
+// after сравнивает запись с курсором в порядке сортировки
+func (token *pageToken) after(mdl Model) bool {
+	value, tokenValue := mdl.sortValue(token.SortBy), token.Value
+	if value == tokenValue {
+		value, tokenValue = mdl.key(), token.Id
+	}
+	if value == tokenValue {
+		return false
+	}
+	return (value > tokenValue) == (token.Order == OrderAsc)
+}
+
+// listQuery собирает SELECT с условиями и параметрами в нумерации postgres ($1, $2...)
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+
+	// COUNT(*) по тем же условиям, но без курсора, и сколько первых аргументов ему нужно
+	count     string
+	countArgs int
+}
+
+func (q *listQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *listQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// build дописывает к запросу условия, курсор, сортировку и лимит.
+// sortExpr должен давать ту же строку, что и sortValue модели, COLLATE "C" -- тот же порядок, что и в go
+func (q *listQuery) build(selectFrom string, sortExpr string, opts ListOptions, cursor *pageToken) string {
+	sortExpr = fmt.Sprintf(`(%s) COLLATE "C"`, sortExpr)
+
+	direction, comparison := "ASC", ">"
+	if opts.Order == OrderDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	q.count = "SELECT COUNT(*) FROM (" + selectFrom + q.whereClause() + ") AS filtered"
+	q.countArgs = len(q.args)
+
+	if cursor != nil {
+		q.where(fmt.Sprintf("(%s, id) %s (%s, %s)", sortExpr, comparison, q.arg(cursor.Value), q.arg(cursor.Id)))
+	}
+
+	return selectFrom + q.whereClause() + fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s",
+		sortExpr, direction, direction, q.arg(opts.Limit+1))
+}
+
+func (q *listQuery) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func (db *Database) selectPage(ctx context.Context, query string, q *listQuery, opts ListOptions,
+	scan func(scanner) (Model, error)) (*Page, error) {
+	rows, err := db.Conn.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		db.log(ctx).Warningf("failed to get list: %v", err)
+		return nil, err
+	}
+
+	result, err := db.scanRows(ctx, rows, scan)
+	if err != nil {
+		return nil, err
+	}
+
+	page := newPage(result, opts)
+	if err = db.Conn.QueryRowContext(ctx, q.count, q.args[:q.countArgs]...).Scan(&page.Total); err != nil {
+		db.log(ctx).Warningf("failed to count list: %v", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// sortModels упорядочивает записи так же, как ORDER BY в selectPage
+func sortModels(list []Model, opts ListOptions) {
+	sort.Slice(list, func(i, j int) bool {
+		left, right := list[i].sortValue(opts.SortBy), list[j].sortValue(opts.SortBy)
+		if left == right {
+			left, right = list[i].key(), list[j].key()
+		}
+		if opts.Order == OrderDesc {
+			return left > right
+		}
+		return left < right
+	})
+}
+
+// likePattern экранирует спецсимволы LIKE для поиска подстроки
+func likePattern(substring string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(substring) + "%"
+}
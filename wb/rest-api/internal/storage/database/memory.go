@@ -0,0 +1,390 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+
+	"github.com/google/uuid"
+)
+
+var _ Storage = &Memory{}
+
+// Memory -- хранилище в памяти процесса, для тестов и локального запуска без PostgreSQL
+type Memory struct {
+	mu             sync.RWMutex
+	tables         map[string]map[string]Model
+	history        []AuditEntry
+	logger         *logging.Logger
+	onClientDelete string
+}
+
+func NewMemoryStorage(dbConfig config.Database, logger *logging.Logger) Storage {
+	logger.Info("new in-memory storage")
+
+	return &Memory{
+		tables:         make(map[string]map[string]Model),
+		logger:         logger,
+		onClientDelete: dbConfig.OnClientDelete,
+	}
+}
+
+func (m *Memory) GetList(ctx context.Context, filter Filter) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	opts := filter.options()
+	cursor, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total := 0
+	result := make([]Model, 0)
+	for _, stored := range m.tables[filter.table()] {
+		if (stored.deletedAt() != nil && !opts.IncludeDeleted) || !filter.matches(stored) {
+			continue
+		}
+		total++
+		if cursor == nil || cursor.after(stored) {
+			result = append(result, stored)
+		}
+	}
+
+	sortModels(result, opts)
+	if len(result) > opts.Limit+1 {
+		result = result[:opts.Limit+1]
+	}
+
+	page := newPage(result, opts)
+	page.Total = total
+	return page, nil
+}
+
+func (m *Memory) Get(ctx context.Context, mdl Model) (Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found, ok := m.tables[mdl.table()][mdl.key()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return found, nil
+}
+
+func (m *Memory) Insert(ctx context.Context, mdl Model) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", contextError(ctx, err)
+	}
+
+	uid, err := uuid.NewUUID()
+	if err != nil {
+		m.log(ctx).Warningf("failed to get new uuid: %v", err)
+		return "", err
+	}
+	id := uid.String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err = m.checkOwner(ownerOf(mdl)); err != nil {
+		return "", err
+	}
+
+	// deleted_at из тела запроса не применяется, как и в PostgreSQL: удаление -- только через Delete
+	if err = m.put(ctx, opCreate, nil, mdl.withId(id).withVersion(InitialVersion).withDeletedAt(nil)); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (m *Memory) Update(ctx context.Context, mdl Model) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.current(mdl)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = m.checkOwner(ownerOf(mdl)); err != nil {
+		return 0, err
+	}
+
+	version := *stored.version() + 1
+	if err = m.put(ctx, opUpdate, stored, mdl.withVersion(version).withDeletedAt(nil)); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (m *Memory) Patch(ctx context.Context, mdl Model, patch Patch) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.current(mdl)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = m.checkOwner(patchStringPtr(patch["owner"])); err != nil {
+		return 0, err
+	}
+
+	version := *stored.version() + 1
+	if err = m.put(ctx, opPatch, stored, stored.applyPatch(patch).withVersion(version)); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, mdl Model) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.current(mdl)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, ok := mdl.(Client); ok {
+		if err = m.releaseMarkets(ctx, mdl.key(), now); err != nil {
+			return err
+		}
+	}
+
+	return m.put(ctx, opDelete, stored, stored.withDeletedAt(&now).withVersion(*stored.version()+1))
+}
+
+func (m *Memory) Restore(ctx context.Context, mdl Model) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.tables[mdl.table()][mdl.key()]
+	switch {
+	case !ok:
+		return 0, ErrNotFound
+	case stored.deletedAt() == nil:
+		return 0, ErrNotDeleted
+	case mdl.version() != nil && *mdl.version() != *stored.version():
+		return 0, ErrVersionMismatch
+	}
+
+	if err := m.checkOwner(ownerOf(stored)); err != nil {
+		return 0, err
+	}
+
+	version := *stored.version() + 1
+	if err := m.put(ctx, opRestore, stored, stored.withDeletedAt(nil).withVersion(version)); err != nil {
+		return 0, err
+	}
+
+	if _, ok = stored.(Client); !ok {
+		return version, nil
+	}
+
+	// магазины, удаленные каскадом вместе с клиентом, помечены тем же временем
+	deletedAt := *stored.deletedAt()
+	for _, market := range m.tables[Market{}.table()] {
+		owner := ownerOf(market)
+		if owner == nil || *owner != mdl.key() || market.deletedAt() == nil || !market.deletedAt().Equal(deletedAt) {
+			continue
+		}
+
+		if err := m.put(ctx, opRestore, market, market.withDeletedAt(nil).withVersion(*market.version()+1)); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+// Purge окончательно удаляет записи, помеченные удаленными раньше deletedBefore.
+// Клиенты, на которых еще ссылаются магазины, остаются до удаления этих магазинов
+func (m *Memory) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	owners := make(map[string]bool)
+	for _, market := range m.tables[Market{}.table()] {
+		if deletedAt := market.deletedAt(); deletedAt != nil && deletedAt.Before(deletedBefore) {
+			if err := m.put(ctx, opPurge, market, nil); err != nil {
+				return purged, err
+			}
+			purged++
+		} else if owner := ownerOf(market); owner != nil {
+			owners[*owner] = true
+		}
+	}
+
+	for id, client := range m.tables[Client{}.table()] {
+		if deletedAt := client.deletedAt(); deletedAt != nil && deletedAt.Before(deletedBefore) && !owners[id] {
+			if err := m.put(ctx, opPurge, client, nil); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *Memory) History(ctx context.Context, mdl Model) ([]AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]AuditEntry, 0)
+	for _, entry := range m.history {
+		if entry.Entity == mdl.table() && entry.EntityId == mdl.key() {
+			entries = append(entries, entry)
+		}
+	}
+
+	if _, ok := m.tables[mdl.table()][mdl.key()]; !ok && len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return entries, nil
+}
+
+// put сохраняет новое состояние записи (nil -- удаляет запись) и добавляет изменение в журнал.
+// Вызывается под m.mu
+func (m *Memory) put(ctx context.Context, operation string, before, after Model) error {
+	entry, err := newAuditEntry(ctx, operation, before, after)
+	if err != nil {
+		m.log(ctx).Warningf("failed to marshal audit entry: %v", err)
+		return err
+	}
+	entry.Id = int64(len(m.history) + 1)
+	m.history = append(m.history, entry)
+
+	rows, ok := m.tables[entry.Entity]
+	if !ok {
+		rows = make(map[string]Model)
+		m.tables[entry.Entity] = rows
+	}
+
+	if after == nil {
+		delete(rows, entry.EntityId)
+	} else {
+		rows[entry.EntityId] = after
+	}
+
+	return nil
+}
+
+// releaseMarkets обрабатывает магазины удаляемого клиента согласно onClientDelete.
+// Вызывается под m.mu
+func (m *Memory) releaseMarkets(ctx context.Context, clientId string, deletedAt time.Time) error {
+	for _, stored := range m.tables[Market{}.table()] {
+		market := stored.(Market)
+		if market.Owner == nil || *market.Owner != clientId {
+			continue
+		}
+
+		var err error
+		switch m.onClientDelete {
+		case config.OnDeleteCascade:
+			if market.DeletedAt == nil {
+				err = m.put(ctx, opDelete, market, market.withDeletedAt(&deletedAt).withVersion(*market.Version+1))
+			}
+		case config.OnDeleteSetNull:
+			released := market
+			released.Owner = nil
+			err = m.put(ctx, opUpdate, market, released.withVersion(*market.Version+1))
+		default:
+			if market.DeletedAt == nil {
+				return ErrOwnerHasMarkets
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkOwner проверяет, что владелец магазина, если он задан, существует и не удален. Вызывается под m.mu
+func (m *Memory) checkOwner(owner *string) error {
+	if owner == nil {
+		return nil
+	}
+
+	client, ok := m.tables[Client{}.table()][*owner]
+	if !ok || client.deletedAt() != nil {
+		return ErrOwnerNotFound
+	}
+
+	return nil
+}
+
+func ownerOf(mdl Model) *string {
+	if market, ok := mdl.(Market); ok {
+		return market.Owner
+	}
+	return nil
+}
+
+// current возвращает сохраненную неудаленную запись, проверяя ожидаемую версию, если она задана.
+// Вызывается под m.mu
+func (m *Memory) current(mdl Model) (Model, error) {
+	stored, ok := m.tables[mdl.table()][mdl.key()]
+	if !ok || stored.deletedAt() != nil {
+		return nil, ErrNotFound
+	}
+
+	if expected := mdl.version(); expected != nil && *expected != *stored.version() {
+		return nil, ErrVersionMismatch
+	}
+
+	return stored, nil
+}
+
+func (m *Memory) log(ctx context.Context) *logging.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+	"wb/rest-api/pkg/metrics"
+)
+
+// model "all" -- операции над всеми таблицами сразу (очистка удаленных записей)
+const modelAll = "all"
+
+var _ Storage = &instrumented{}
+
+// instrumented считает задержку и ошибки каждой операции хранилища по модели и операции
+type instrumented struct {
+	storage  Storage
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+// Instrument оборачивает хранилище метриками; для PostgreSQL также отдает состояние пула соединений
+func Instrument(storage Storage, registry *metrics.Registry) Storage {
+	if db, ok := storage.(*Database); ok {
+		registerPoolMetrics(db, registry)
+	}
+
+	return &instrumented{
+		storage: storage,
+		duration: registry.Histogram("storage_operation_duration_seconds",
+			"Duration of storage operations.", metrics.DefaultBuckets, "model", "operation"),
+		errors: registry.Counter("storage_operation_errors_total",
+			"Failed storage operations by error kind.", "model", "operation", "kind"),
+	}
+}
+
+func registerPoolMetrics(db *Database, registry *metrics.Registry) {
+	registry.GaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Conn.Stats().MaxOpenConnections) })
+	registry.GaugeFunc("db_open_connections", "Established connections both in use and idle.",
+		func() float64 { return float64(db.Conn.Stats().OpenConnections) })
+	registry.GaugeFunc("db_in_use_connections", "Connections currently in use.",
+		func() float64 { return float64(db.Conn.Stats().InUse) })
+	registry.GaugeFunc("db_idle_connections", "Idle connections.",
+		func() float64 { return float64(db.Conn.Stats().Idle) })
+	registry.CounterFunc("db_wait_count_total", "Total number of connections waited for.",
+		func() float64 { return float64(db.Conn.Stats().WaitCount) })
+	registry.CounterFunc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+		func() float64 { return db.Conn.Stats().WaitDuration.Seconds() })
+}
+
+// observe записывает задержку операции и, если она завершилась ошибкой, ее вид
+func (s *instrumented) observe(model, operation string, start time.Time, err error) {
+	s.duration.Observe(time.Since(start).Seconds(), model, operation)
+	if err != nil {
+		s.errors.Inc(model, operation, errorKind(err))
+	}
+}
+
+// errorKind -- вид ошибки для метки: ожидаемые ответы (нет записи, конфликт) отделяются от сбоев БД
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrVersionMismatch):
+		return "version_mismatch"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrInvalidInput), errors.Is(err, ErrInvalidPageToken):
+		return "invalid_input"
+	case errors.Is(err, ErrQueryTimeout):
+		return "timeout"
+	case errors.Is(err, ErrQueryCanceled):
+		return "canceled"
+	case errors.Is(err, ErrUnavailable):
+		return "unavailable"
+	}
+	return "internal"
+}
+
+func (s *instrumented) GetList(ctx context.Context, filter Filter) (*Page, error) {
+	start := time.Now()
+	page, err := s.storage.GetList(ctx, filter)
+	s.observe(filter.table(), "get_list", start, err)
+	return page, err
+}
+
+func (s *instrumented) Get(ctx context.Context, mdl Model) (Model, error) {
+	start := time.Now()
+	found, err := s.storage.Get(ctx, mdl)
+	s.observe(mdl.table(), "get", start, err)
+	return found, err
+}
+
+func (s *instrumented) Insert(ctx context.Context, mdl Model) (string, error) {
+	start := time.Now()
+	id, err := s.storage.Insert(ctx, mdl)
+	s.observe(mdl.table(), "insert", start, err)
+	return id, err
+}
+
+func (s *instrumented) Delete(ctx context.Context, mdl Model) error {
+	start := time.Now()
+	err := s.storage.Delete(ctx, mdl)
+	s.observe(mdl.table(), "delete", start, err)
+	return err
+}
+
+func (s *instrumented) Restore(ctx context.Context, mdl Model) (int, error) {
+	start := time.Now()
+	version, err := s.storage.Restore(ctx, mdl)
+	s.observe(mdl.table(), "restore", start, err)
+	return version, err
+}
+
+func (s *instrumented) Update(ctx context.Context, mdl Model) (int, error) {
+	start := time.Now()
+	version, err := s.storage.Update(ctx, mdl)
+	s.observe(mdl.table(), "update", start, err)
+	return version, err
+}
+
+func (s *instrumented) Patch(ctx context.Context, mdl Model, patch Patch) (int, error) {
+	start := time.Now()
+	version, err := s.storage.Patch(ctx, mdl, patch)
+	s.observe(mdl.table(), "patch", start, err)
+	return version, err
+}
+
+func (s *instrumented) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	start := time.Now()
+	purged, err := s.storage.Purge(ctx, deletedBefore)
+	s.observe(modelAll, "purge", start, err)
+	return purged, err
+}
+
+func (s *instrumented) History(ctx context.Context, mdl Model) ([]AuditEntry, error) {
+	start := time.Now()
+	entries, err := s.storage.History(ctx, mdl)
+	s.observe(mdl.table(), "history", start, err)
+	return entries, err
+}
+
+func (s *instrumented) Checks() []Check {
+	return s.storage.Checks()
+}
+
+func (s *instrumented) Close() error {
+	return s.storage.Close()
+}
@@ -0,0 +1,342 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wb/rest-api/pkg/logging"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	createMigrationsTable = "CREATE TABLE IF NOT EXISTS schema_migrations " +
+		"(version integer PRIMARY KEY, name varchar(100) NOT NULL, applied_at timestamptz NOT NULL DEFAULT now())"
+	getMigrations    = "SELECT version, applied_at FROM schema_migrations"
+	insertMigration  = "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	deleteMigration  = "DELETE FROM schema_migrations WHERE version = $1"
+	currentMigration = "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"
+	migrationsExist  = "SELECT to_regclass('schema_migrations') IS NOT NULL"
+
+	// произвольный ключ, чтобы два процесса не применяли миграции одновременно
+	migrationLockKey = 7305819
+)
+
+var ErrUnknownMigration = errors.New("unknown migration version")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// querier -- общий интерфейс *sql.DB и *sql.Conn: To выполняет все запросы на соединении,
+// которое держит блокировку, а не берет из пула второе
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator применяет встроенные в бинарник миграции из каталога migrations.
+// Файлы называются "<версия>_<имя>.up.sql" и "<версия>_<имя>.down.sql"
+type Migrator struct {
+	conn       *sql.DB
+	logger     *logging.Logger
+	migrations []Migration
+}
+
+func NewMigrator(conn *sql.DB, logger *logging.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		logger.Warningf("failed to load migrations: %v", err)
+		return nil, err
+	}
+
+	return &Migrator{
+		conn:       conn,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionPart, migrationName, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d should have both up and down files", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest -- версия последней встроенной миграции
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Current -- версия, до которой мигрирована БД
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	return m.current(ctx, m.conn)
+}
+
+func (m *Migrator) current(ctx context.Context, q querier) (int, error) {
+	if _, err := q.ExecContext(ctx, createMigrationsTable); err != nil {
+		m.logger.Warningf("failed to create schema_migrations: %v", err)
+		return 0, err
+	}
+
+	var version int
+	if err := q.QueryRowContext(ctx, currentMigration).Scan(&version); err != nil {
+		m.logger.Warningf("failed to get current migration: %v", err)
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Applied -- как Current, но только читает: без таблицы schema_migrations версия 0.
+// Для проверок готовности, которым нельзя выполнять DDL
+func (m *Migrator) Applied(ctx context.Context) (int, error) {
+	var exists bool
+	if err := m.conn.QueryRowContext(ctx, migrationsExist).Scan(&exists); err != nil {
+		m.logger.Warningf("failed to check schema_migrations: %v", err)
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := m.conn.QueryRowContext(ctx, currentMigration).Scan(&version); err != nil {
+		m.logger.Warningf("failed to get current migration: %v", err)
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if _, err := m.Current(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.conn.QueryContext(ctx, getMigrations)
+	if err != nil {
+		m.logger.Warningf("failed to get migrations: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			m.logger.Warningf("failed to scan row: %v", err)
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logger.Warningf("failed to iterate rows: %v", err)
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+// Up применяет все непримененные миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := 0
+	for _, migration := range m.migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+
+	return m.To(ctx, target)
+}
+
+// To применяет или откатывает миграции, пока БД не окажется на версии target (0 -- пустая схема)
+func (m *Migrator) To(ctx context.Context, target int) error {
+	if target != 0 && m.find(target) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+	}
+
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		m.logger.Warningf("failed to get connection: %v", err)
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		m.logger.Warningf("failed to lock migrations: %v", err)
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	current, err := m.current(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if current == target {
+		m.logger.Infof("schema is already at version %d", current)
+		return nil
+	}
+
+	if current < target {
+		for _, migration := range m.migrations {
+			if migration.Version > current && migration.Version <= target {
+				if err = m.apply(ctx, conn, migration, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= current && migration.Version > target {
+			if err = m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply выполняет миграцию и запись в schema_migrations в одной транзакции
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	direction, script := "up", migration.Up
+	if !up {
+		direction, script = "down", migration.Down
+	}
+	m.logger.Infof("migrate %s: %d_%s", direction, migration.Version, migration.Name)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		m.logger.Warningf("failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		m.logger.Warningf("failed to migrate %s %d: %v", direction, migration.Version, err)
+		return fmt.Errorf("migration %d_%s %s: %v", migration.Version, migration.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, insertMigration, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, deleteMigration, migration.Version)
+	}
+	if err != nil {
+		m.logger.Warningf("failed to update schema_migrations: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
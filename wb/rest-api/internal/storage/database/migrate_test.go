@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	// версии идут подряд с 1, у каждой миграции есть оба направления
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %d_%s: version should be %d", migration.Version, migration.Name, i+1)
+		}
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Fatalf("migration %d_%s: empty up or down script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestMigratorUnknownVersion(t *testing.T) {
+	migrator, err := NewMigrator(nil, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// неизвестная версия отклоняется до обращения к БД
+	if err = migrator.To(context.Background(), migrator.Latest()+1); !errors.Is(err, ErrUnknownMigration) {
+		t.Fatalf("error = %v, want %v", err, ErrUnknownMigration)
+	}
+}
+
+// fakeConnector -- драйвер, которому достаточно запросов Migrator: запоминает примененные версии
+type fakeConnector struct {
+	mu      sync.Mutex
+	applied []int64
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+
+	switch query {
+	case insertMigration:
+		c.connector.applied = append(c.connector.applied, args[0].Value.(int64))
+	case deleteMigration:
+		c.connector.applied = c.connector.applied[:len(c.connector.applied)-1]
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if query == migrationsExist {
+		return &fakeRows{values: []driver.Value{true}}, nil
+	}
+	if query != currentMigration {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+
+	var current int64
+	if len(c.connector.applied) > 0 {
+		current = c.connector.applied[len(c.connector.applied)-1]
+	}
+	return &fakeRows{values: []driver.Value{current}}, nil
+}
+
+type fakeRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"version"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+func TestMigratorToSingleConnection(t *testing.T) {
+	connector := &fakeConnector{}
+	conn := sql.OpenDB(connector)
+	defer conn.Close()
+	// блокировка держит единственное соединение пула: все запросы To должны идти через него
+	conn.SetMaxOpenConns(1)
+
+	migrator, err := NewMigrator(conn, logging.GetLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = migrator.To(ctx, migrator.Latest()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if len(connector.applied) != migrator.Latest() {
+		t.Fatalf("applied %v, want %d migrations", connector.applied, migrator.Latest())
+	}
+
+	if err = migrator.To(ctx, 1); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if len(connector.applied) != 1 {
+		t.Fatalf("applied %v after migrate down to 1", connector.applied)
+	}
+}
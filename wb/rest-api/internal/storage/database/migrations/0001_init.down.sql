@@ -0,0 +1,2 @@
+drop table if exists markets;
+drop table if exists clients;
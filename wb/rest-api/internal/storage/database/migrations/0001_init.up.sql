@@ -1,4 +1,4 @@
-create table clients
+create table if not exists clients
 (
     id                uuid not null
         primary key,
@@ -9,10 +9,7 @@ create table clients
     registration_date varchar(20)
 );
 
-alter table clients
-    owner to postgres;
-
-create table markets
+create table if not exists markets
 (
     id      uuid not null
         primary key,
@@ -21,6 +18,3 @@ create table markets
     active  boolean,
     owner   varchar(20)
 );
-
-alter table markets
-    owner to postgres;
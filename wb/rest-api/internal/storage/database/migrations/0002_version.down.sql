@@ -0,0 +1,5 @@
+alter table markets
+    drop column if exists version;
+
+alter table clients
+    drop column if exists version;
@@ -0,0 +1,5 @@
+alter table clients
+    add column if not exists version integer default 1 not null;
+
+alter table markets
+    add column if not exists version integer default 1 not null;
@@ -0,0 +1,8 @@
+drop index if exists markets_owner_idx;
+
+alter table markets
+    drop constraint if exists markets_owner_fkey;
+
+-- id клиента не помещается в прежний varchar(20)
+alter table markets
+    alter column owner type varchar(36) using owner::text;
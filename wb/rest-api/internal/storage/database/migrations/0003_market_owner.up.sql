@@ -0,0 +1,15 @@
+-- владелец магазина теперь ссылается на клиента;
+-- значения, которые не являются id существующего клиента, очищаются
+update markets
+set owner = null
+where owner is not null
+  and (owner !~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$'
+    or not exists(select 1 from clients where clients.id::text = lower(markets.owner)));
+
+alter table markets
+    alter column owner type uuid using owner::uuid;
+
+alter table markets
+    add constraint markets_owner_fkey foreign key (owner) references clients (id);
+
+create index if not exists markets_owner_idx on markets (owner);
@@ -0,0 +1,20 @@
+-- помеченные записи удаляются, иначе после отката они снова станут видны
+delete from markets
+where deleted_at is not null;
+
+update markets
+set owner = null
+where owner in (select id from clients where deleted_at is not null);
+
+delete from clients
+where deleted_at is not null;
+
+drop index if exists markets_deleted_at_idx;
+
+drop index if exists clients_deleted_at_idx;
+
+alter table markets
+    drop column if exists deleted_at;
+
+alter table clients
+    drop column if exists deleted_at;
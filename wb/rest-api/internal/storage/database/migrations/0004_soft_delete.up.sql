@@ -0,0 +1,10 @@
+-- удаленные записи помечаются временем удаления и окончательно удаляются после срока хранения
+alter table clients
+    add column if not exists deleted_at timestamptz;
+
+alter table markets
+    add column if not exists deleted_at timestamptz;
+
+create index if not exists clients_deleted_at_idx on clients (deleted_at) where deleted_at is not null;
+
+create index if not exists markets_deleted_at_idx on markets (deleted_at) where deleted_at is not null;
@@ -0,0 +1,31 @@
+-- журнал изменений клиентов и магазинов, записи в нем только добавляются
+create table if not exists audit_log
+(
+    id         bigserial primary key,
+    entity     varchar(16) not null,
+    entity_id  uuid        not null,
+    operation  varchar(16) not null,
+    before     jsonb,
+    after      jsonb,
+    changed_at timestamptz not null default now(),
+    request_id text,
+    caller     text
+);
+
+create index if not exists audit_log_entity_idx on audit_log (entity, entity_id, id);
+
+create or replace function audit_log_append_only() returns trigger
+    language plpgsql as
+$$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$;
+
+drop trigger if exists audit_log_append_only on audit_log;
+
+create trigger audit_log_append_only
+    before update or delete
+    on audit_log
+    for each row
+execute procedure audit_log_append_only();
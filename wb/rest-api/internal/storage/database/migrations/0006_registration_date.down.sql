@@ -0,0 +1 @@
+drop function if exists registration_date_value(text);
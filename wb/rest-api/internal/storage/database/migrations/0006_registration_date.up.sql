@@ -0,0 +1,13 @@
+-- старые записи могли сохранить registration_date не в формате DD-MM-YYYY:
+-- для сортировки и фильтров по дате такие значения считаются пустыми, а не ломают запрос
+create or replace function registration_date_value(value text) returns date as $$
+begin
+    if value !~ '^\d{2}-\d{2}-\d{4}$' then
+        return null;
+    end if;
+    return to_date(value, 'DD-MM-YYYY');
+exception
+    when data_exception then
+        return null;
+end;
+$$ language plpgsql immutable;
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"time"
+	"wb/rest-api/internal/config"
 	"wb/rest-api/pkg/logging"
 )
 
@@ -11,19 +17,39 @@ var _ Model = &Market{}
 
 type Model interface {
 	Marshal(*logging.Logger) ([]byte, error)
-	GetList(*Database) ([]Model, error)
-	Insert(*Database) (string, error)
-	Update(*Database) error
-	Delete(*Database) error
+	Get(context.Context, *Database) (Model, error)
+	Insert(context.Context, *Database) (string, error)
+	Update(context.Context, *Database) (int, error)
+	Patch(context.Context, *Database, Patch) (int, error)
+	Delete(context.Context, *Database) error
+	Restore(context.Context, *Database) (int, error)
+
+	// для хранилища в памяти
+	table() string
+	key() string
+	withId(string) Model
+	version() *int
+	withVersion(int) Model
+	deletedAt() *time.Time
+	withDeletedAt(*time.Time) Model
+	sortValue(string) string
+	applyPatch(Patch) Model
+}
+
+// scanner -- общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
 }
 
 type Client struct {
-	Id               *string `json:"id,omitempty"`
-	LastName         string  `json:"last_name"`
-	FirstName        string  `json:"first_name"`
-	Patronymic       string  `json:"patronymic"`
-	Age              *int    `json:"age,omitempty"`
-	RegistrationDate string  `json:"registration_date"`
+	Id               *string    `json:"id,omitempty"`
+	LastName         string     `json:"last_name"`
+	FirstName        string     `json:"first_name"`
+	Patronymic       string     `json:"patronymic"`
+	Age              *int       `json:"age,omitempty"`
+	RegistrationDate string     `json:"registration_date"`
+	Version          *int       `json:"version,omitempty"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
 }
 
 func (c Client) Marshal(logger *logging.Logger) ([]byte, error) {
@@ -36,93 +62,311 @@ func (c Client) Marshal(logger *logging.Logger) ([]byte, error) {
 	return data, nil
 }
 
+func (c Client) table() string {
+	return "clients"
+}
+
+func (c Client) key() string {
+	if c.Id == nil {
+		return ""
+	}
+	return *c.Id
+}
+
+func (c Client) withId(id string) Model {
+	c.Id = &id
+	return c
+}
+
+func (c Client) version() *int {
+	return c.Version
+}
+
+func (c Client) withVersion(version int) Model {
+	c.Version = &version
+	return c
+}
+
+func (c Client) deletedAt() *time.Time {
+	return c.DeletedAt
+}
+
+func (c Client) withDeletedAt(deletedAt *time.Time) Model {
+	c.DeletedAt = deletedAt
+	return c
+}
+
+func (c Client) sortValue(key string) string {
+	switch key {
+	case "id":
+		return c.key()
+	case "first_name":
+		return c.FirstName
+	case "patronymic":
+		return c.Patronymic
+	case "age":
+		age := 0
+		if c.Age != nil {
+			age = *c.Age
+		}
+		return fmt.Sprintf("%03d", age)
+	case "registration_date":
+		return sortableDate(c.RegistrationDate)
+	default:
+		return c.LastName
+	}
+}
+
 const (
-	getByLastNameClient = "SELECT id, last_name, first_name, patronymic, age, registration_date FROM clients WHERE last_name = $1"
-	insertClient        = "INSERT INTO clients (id, last_name, first_name, patronymic, age, registration_date) VALUES ($1, $2, $3, $4, $5,$6)"
-	updClient           = "UPDATE clients SET last_name=$1, first_name=$2, patronymic=$3, age=$4, registration_date=$5 WHERE id=$6"
-	deleteClient        = "DELETE FROM clients WHERE id = $1"
+	getClient    = selectClients + " WHERE id = $1"
+	lockClient   = getClient + " FOR UPDATE"
+	insertClient = "INSERT INTO clients (id, last_name, first_name, patronymic, age, registration_date) VALUES ($1, $2, $3, $4, $5,$6)"
+	updClient    = "UPDATE clients SET last_name=$1, first_name=$2, patronymic=$3, age=$4, registration_date=$5, version=version+1 " +
+		"WHERE id=$6 RETURNING version"
+	deleteClient  = "UPDATE clients SET deleted_at = now(), version = version+1 WHERE id = $1"
+	restoreClient = "UPDATE clients SET deleted_at = NULL, version = version+1 WHERE id = $1 RETURNING version"
+	// FOR KEY SHARE конфликтует с FOR UPDATE из удаления клиента: магазин не привяжется к клиенту,
+	// которого параллельно удаляют
+	lockOwner = "SELECT 1 FROM clients WHERE id = $1 AND deleted_at IS NULL FOR KEY SHARE"
+
+	clientOwnsMarkets = "SELECT EXISTS(SELECT 1 FROM markets WHERE owner = $1 AND deleted_at IS NULL)"
+	lockClientMarkets = selectMarkets + " WHERE owner = $1 AND deleted_at IS NULL FOR UPDATE"
+	lockOwnedMarkets  = selectMarkets + " WHERE owner = $1 FOR UPDATE"
+	// магазины, удаленные каскадом вместе с клиентом, помечены тем же временем (now() постоянно в транзакции)
+	lockCascadeMarkets = selectMarkets + " WHERE owner = $1 AND deleted_at = $2 FOR UPDATE"
 )
 
-func (c Client) GetList(db *Database) ([]Model, error) {
-	result := make([]Model, 0)
-	rows, err := db.Conn.Query(getByLastNameClient, c.LastName)
+func scanClient(row scanner) (Client, error) {
+	client := Client{}
+	err := row.Scan(
+		&client.Id,
+		&client.LastName,
+		&client.FirstName,
+		&client.Patronymic,
+		&client.Age,
+		&client.RegistrationDate,
+		&client.Version,
+		&client.DeletedAt)
+	return client, err
+}
+
+func (c Client) Get(ctx context.Context, db *Database) (Model, error) {
+	client, err := scanClient(db.Conn.QueryRowContext(ctx, getClient, c.Id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		db.logger.Warningf("failed to get client by LastName: %v", err)
+		db.log(ctx).Warningf("failed to get client by id: %v", err)
 		return nil, err
 	}
 
-	for rows.Next() {
-		client := Client{}
-		err = rows.Scan(
-			&client.Id,
-			&client.LastName,
-			&client.FirstName,
-			&client.Patronymic,
-			&client.Age,
-			&client.RegistrationDate)
-		if err != nil {
-			db.logger.Warningf("failed to scan row: %v", err)
-			return nil, err
-		}
-		result = append(result, client)
-	}
-
-	return result, nil
+	return client, nil
 }
 
-func (c Client) Insert(db *Database) (string, error) {
+func (c Client) Insert(ctx context.Context, db *Database) (string, error) {
 	uid, err := uuid.NewUUID()
 	if err != nil {
-		db.logger.Warningf("failed to get new uuid: %v", err)
+		db.log(ctx).Warningf("failed to get new uuid: %v", err)
 		return "", err
 	}
 
 	id := uid.String()
-	_, err = db.Conn.Exec(insertClient,
-		id,
-		c.LastName,
-		c.FirstName,
-		c.Patronymic,
-		c.Age,
-		c.RegistrationDate)
+	err = db.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, insertClient,
+			id,
+			c.LastName,
+			c.FirstName,
+			c.Patronymic,
+			c.Age,
+			c.RegistrationDate)
+		if err != nil {
+			db.log(ctx).Warningf("failed to insert client: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opCreate, nil, c.withId(id))
+	})
 	if err != nil {
-		db.logger.Warningf("failed to insert client: %v", err)
 		return "", err
 	}
 
-	return id, err
+	return id, nil
 }
 
-func (c Client) Update(db *Database) error {
-	_, err := db.Conn.Exec(updClient,
-		c.LastName,
-		c.FirstName,
-		c.Patronymic,
-		c.Age,
-		c.RegistrationDate,
-		c.Id)
-	if err != nil {
-		db.logger.Warningf("failed to update client: %v", err)
+func (c Client) Update(ctx context.Context, db *Database) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, updClient,
+			c.LastName,
+			c.FirstName,
+			c.Patronymic,
+			c.Age,
+			c.RegistrationDate,
+			c.Id).Scan(&version)
+		if err != nil {
+			db.log(ctx).Warningf("failed to update client: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opUpdate, before, c)
+	})
+
+	return version, err
+}
+
+func (c Client) Patch(ctx context.Context, db *Database, patch Patch) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		query, args := patch.update(c.table(), c.Id)
+		if err = tx.QueryRowContext(ctx, query, args...).Scan(&version); err != nil {
+			db.log(ctx).Warningf("failed to patch client: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opPatch, before, c)
+	})
+
+	return version, err
+}
+
+func (c Client) applyPatch(patch Patch) Model {
+	for column, value := range patch {
+		switch column {
+		case "last_name":
+			c.LastName = patchString(value)
+		case "first_name":
+			c.FirstName = patchString(value)
+		case "patronymic":
+			c.Patronymic = patchString(value)
+		case "registration_date":
+			c.RegistrationDate = patchString(value)
+		case "age":
+			c.Age = nil
+			if age, ok := value.(int); ok {
+				c.Age = &age
+			}
+		}
 	}
+	return c
+}
+
+// Delete помечает клиента удаленным, магазины клиента обрабатываются согласно onClientDelete
+func (c Client) Delete(ctx context.Context, db *Database) error {
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, c)
+		if err != nil {
+			return err
+		}
 
-	return err
+		if err = c.releaseMarkets(ctx, db, tx); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, deleteClient, c.Id); err != nil {
+			db.log(ctx).Warningf("failed to delete client: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opDelete, before, c)
+	})
 }
 
-func (c Client) Delete(db *Database) error {
-	_, err := db.Conn.Exec(deleteClient, c.Id)
+// releaseMarkets удаляет магазины клиента или очищает у них владельца согласно onClientDelete
+func (c Client) releaseMarkets(ctx context.Context, db *Database, tx *sql.Tx) error {
+	query, lockQuery, operation := deleteMarket, lockClientMarkets, opDelete
+	switch db.onClientDelete {
+	case config.OnDeleteCascade:
+	case config.OnDeleteSetNull:
+		query, lockQuery, operation = releaseMarket, lockOwnedMarkets, opUpdate
+	default:
+		var owns bool
+		if err := tx.QueryRowContext(ctx, clientOwnsMarkets, c.Id).Scan(&owns); err != nil {
+			db.log(ctx).Warningf("failed to check client markets: %v", err)
+			return err
+		}
+		if owns {
+			return ErrOwnerHasMarkets
+		}
+		return nil
+	}
+
+	markets, err := db.lockRows(ctx, tx, lockQuery, marketRow, c.Id)
 	if err != nil {
-		db.logger.Warningf("failed to delete client: %v", err)
+		return err
+	}
+
+	for _, market := range markets {
+		if _, err = tx.ExecContext(ctx, query, market.key()); err != nil {
+			db.log(ctx).Warningf("failed to process client markets: %v", err)
+			return err
+		}
+
+		if err = db.auditChange(ctx, tx, operation, market, market); err != nil {
+			return err
+		}
 	}
 
-	return err
+	return nil
+}
+
+// Restore снимает пометку удаления с клиента и с магазинов, удаленных вместе с ним
+func (c Client) Restore(ctx context.Context, db *Database) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.lockDeleted(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.QueryRowContext(ctx, restoreClient, c.Id).Scan(&version); err != nil {
+			db.log(ctx).Warningf("failed to restore client: %v", err)
+			return err
+		}
+
+		if err = db.auditChange(ctx, tx, opRestore, before, c); err != nil {
+			return err
+		}
+
+		markets, err := db.lockRows(ctx, tx, lockCascadeMarkets, marketRow, c.Id, before.deletedAt())
+		if err != nil {
+			return err
+		}
+
+		for _, market := range markets {
+			if _, err = tx.ExecContext(ctx, restoreMarket, market.key()); err != nil {
+				db.log(ctx).Warningf("failed to restore client markets: %v", err)
+				return err
+			}
+
+			if err = db.auditChange(ctx, tx, opRestore, market, market); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return version, err
 }
 
 type Market struct {
-	Id      *string `json:"id,omitempty"`
-	Name    string  `json:"name"`
-	Address string  `json:"address"`
-	Active  bool    `json:"active"`
-	Owner   *string `json:"owner,omitempty"`
+	Id        *string    `json:"id,omitempty"`
+	Name      string     `json:"name"`
+	Address   string     `json:"address"`
+	Active    bool       `json:"active"`
+	Owner     *string    `json:"owner,omitempty"`
+	Version   *int       `json:"version,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func (m Market) Marshal(logger *logging.Logger) ([]byte, error) {
@@ -134,80 +378,236 @@ func (m Market) Marshal(logger *logging.Logger) ([]byte, error) {
 	return data, nil
 }
 
+func (m Market) table() string {
+	return "markets"
+}
+
+func (m Market) key() string {
+	if m.Id == nil {
+		return ""
+	}
+	return *m.Id
+}
+
+func (m Market) withId(id string) Model {
+	m.Id = &id
+	return m
+}
+
+func (m Market) version() *int {
+	return m.Version
+}
+
+func (m Market) withVersion(version int) Model {
+	m.Version = &version
+	return m
+}
+
+func (m Market) deletedAt() *time.Time {
+	return m.DeletedAt
+}
+
+func (m Market) withDeletedAt(deletedAt *time.Time) Model {
+	m.DeletedAt = deletedAt
+	return m
+}
+
+func (m Market) sortValue(key string) string {
+	switch key {
+	case "id":
+		return m.key()
+	case "address":
+		return m.Address
+	case "active":
+		if m.Active {
+			return "1"
+		}
+		return "0"
+	case "owner":
+		if m.Owner == nil {
+			return ""
+		}
+		return *m.Owner
+	default:
+		return m.Name
+	}
+}
+
 const (
-	getByNameMarket = "SELECT id, name, address, active, owner FROM markets WHERE name = $1"
-	insertMarket    = "INSERT INTO markets (id, name, address, active, owner) VALUES ($1, $2, $3, $4, $5)"
-	updMarket       = "UPDATE markets SET name=$1, address=$2, active=$3, owner=$4 WHERE id=$5"
-	deleteMarket    = "DELETE FROM markets WHERE id = $1"
+	getMarket    = selectMarkets + " WHERE id = $1"
+	lockMarket   = getMarket + " FOR UPDATE"
+	insertMarket = "INSERT INTO markets (id, name, address, active, owner) VALUES ($1, $2, $3, $4, $5)"
+	updMarket    = "UPDATE markets SET name=$1, address=$2, active=$3, owner=$4, version=version+1 " +
+		"WHERE id=$5 RETURNING version"
+	deleteMarket  = "UPDATE markets SET deleted_at = now(), version = version+1 WHERE id = $1"
+	releaseMarket = "UPDATE markets SET owner = NULL, version = version+1 WHERE id = $1"
+	restoreMarket = "UPDATE markets SET deleted_at = NULL, version = version+1 WHERE id = $1 RETURNING version"
 )
 
-func (m Market) GetList(db *Database) ([]Model, error) {
-	result := make([]Model, 0)
-	rows, err := db.Conn.Query(getByNameMarket, m.Name)
+func scanMarket(row scanner) (Market, error) {
+	market := Market{}
+	err := row.Scan(
+		&market.Id,
+		&market.Name,
+		&market.Address,
+		&market.Active,
+		&market.Owner,
+		&market.Version,
+		&market.DeletedAt)
+	return market, err
+}
+
+func (m Market) Get(ctx context.Context, db *Database) (Model, error) {
+	market, err := scanMarket(db.Conn.QueryRowContext(ctx, getMarket, m.Id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		db.logger.Warningf("failed to get market by Name: %v", err)
+		db.log(ctx).Warningf("failed to get market by id: %v", err)
 		return nil, err
 	}
 
-	for rows.Next() {
-		market := Market{}
-		err = rows.Scan(
-			&market.Id,
-			&market.Name,
-			&market.Address,
-			&market.Active,
-			&market.Owner)
-		if err != nil {
-			db.logger.Warningf("failed to scan row: %v", err)
-			return nil, err
-		}
-		result = append(result, market)
-	}
-
-	return result, nil
+	return market, nil
 }
 
-func (m Market) Insert(db *Database) (string, error) {
+func (m Market) Insert(ctx context.Context, db *Database) (string, error) {
 	uid, err := uuid.NewUUID()
 	if err != nil {
-		db.logger.Warningf("failed to get new uuid: %v", err)
+		db.log(ctx).Warningf("failed to get new uuid: %v", err)
 		return "", err
 	}
 
 	id := uid.String()
-	_, err = db.Conn.Exec(insertMarket,
-		id,
-		m.Name,
-		m.Address,
-		m.Active,
-		m.Owner)
+	err = db.inTx(ctx, func(tx *sql.Tx) error {
+		if err := db.checkOwner(ctx, tx, m.Owner); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, insertMarket,
+			id,
+			m.Name,
+			m.Address,
+			m.Active,
+			m.Owner)
+		if err != nil {
+			db.log(ctx).Warningf("failed to insert market: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opCreate, nil, m.withId(id))
+	})
 	if err != nil {
-		db.logger.Warningf("failed to insert market: %v", err)
 		return "", err
 	}
 
-	return id, err
+	return id, nil
 }
 
-func (m Market) Update(db *Database) error {
-	_, err := db.Conn.Exec(updMarket,
-		m.Name,
-		m.Address,
-		m.Active,
-		m.Owner,
-		m.Id)
-	if err != nil {
-		db.logger.Warningf("failed to update market: %v", err)
-	}
+func (m Market) Update(ctx context.Context, db *Database) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+
+		if err = db.checkOwner(ctx, tx, m.Owner); err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, updMarket,
+			m.Name,
+			m.Address,
+			m.Active,
+			m.Owner,
+			m.Id).Scan(&version)
+		if err != nil {
+			db.log(ctx).Warningf("failed to update market: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opUpdate, before, m)
+	})
 
-	return err
+	return version, err
 }
 
-func (m Market) Delete(db *Database) error {
-	_, err := db.Conn.Exec(deleteMarket, m.Id)
-	if err != nil {
-		db.logger.Warningf("failed to delete market: %v", err)
+func (m Market) Patch(ctx context.Context, db *Database, patch Patch) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+
+		if err = db.checkOwner(ctx, tx, patchStringPtr(patch["owner"])); err != nil {
+			return err
+		}
+
+		query, args := patch.update(m.table(), m.Id)
+		if err = tx.QueryRowContext(ctx, query, args...).Scan(&version); err != nil {
+			db.log(ctx).Warningf("failed to patch market: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opPatch, before, m)
+	})
+
+	return version, err
+}
+
+func (m Market) applyPatch(patch Patch) Model {
+	for column, value := range patch {
+		switch column {
+		case "name":
+			m.Name = patchString(value)
+		case "address":
+			m.Address = patchString(value)
+		case "active":
+			m.Active, _ = value.(bool)
+		case "owner":
+			m.Owner = patchStringPtr(value)
+		}
 	}
+	return m
+}
+
+func (m Market) Delete(ctx context.Context, db *Database) error {
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.current(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, deleteMarket, m.Id); err != nil {
+			db.log(ctx).Warningf("failed to delete market: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opDelete, before, m)
+	})
+}
+
+// Restore снимает пометку удаления, если владелец магазина не удален
+func (m Market) Restore(ctx context.Context, db *Database) (int, error) {
+	var version int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := db.lockDeleted(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+
+		if err = db.checkOwner(ctx, tx, ownerOf(before)); err != nil {
+			return err
+		}
+
+		if err = tx.QueryRowContext(ctx, restoreMarket, m.Id).Scan(&version); err != nil {
+			db.log(ctx).Warningf("failed to restore market: %v", err)
+			return err
+		}
+
+		return db.auditChange(ctx, tx, opRestore, before, m)
+	})
 
-	return err
+	return version, err
 }
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Patch -- новые значения колонок для частичного обновления, nil означает NULL
+type Patch map[string]interface{}
+
+// колонки, которые можно менять через PATCH, и тип их значений
+var clientPatchColumns = map[string]func() interface{}{
+	"last_name":         func() interface{} { return new(string) },
+	"first_name":        func() interface{} { return new(string) },
+	"patronymic":        func() interface{} { return new(string) },
+	"age":               func() interface{} { return new(int) },
+	"registration_date": func() interface{} { return new(string) },
+}
+
+var marketPatchColumns = map[string]func() interface{}{
+	"name":    func() interface{} { return new(string) },
+	"address": func() interface{} { return new(string) },
+	"active":  func() interface{} { return new(bool) },
+	"owner":   func() interface{} { return new(string) },
+}
+
+func (c Client) ParsePatch(data []byte) (Patch, error) {
+	return parsePatch(data, clientPatchColumns)
+}
+
+func (m Market) ParsePatch(data []byte) (Patch, error) {
+	return parsePatch(data, marketPatchColumns)
+}
+
+// parsePatch оставляет только переданные поля, чтобы отличать отсутствующее поле от явного null
+func parsePatch(data []byte, columns map[string]func() interface{}) (Patch, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	patch := make(Patch)
+	for name, raw := range fields {
+		newValue, ok := columns[name]
+		if !ok {
+			continue
+		}
+
+		if string(raw) == "null" {
+			patch[name] = nil
+			continue
+		}
+
+		value := newValue()
+		if err := json.Unmarshal(raw, value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %v", name, err)
+		}
+
+		switch v := value.(type) {
+		case *string:
+			patch[name] = *v
+		case *int:
+			patch[name] = *v
+		case *bool:
+			patch[name] = *v
+		}
+	}
+
+	return patch, nil
+}
+
+// update собирает UPDATE только по переданным колонкам; имена колонок берутся из *PatchColumns
+func (p Patch) update(table string, id *string) (string, []interface{}) {
+	set := make([]string, 0, len(p)+1)
+	args := make([]interface{}, 0, len(p)+1)
+	for _, column := range sortKeys(p) {
+		args = append(args, p[column])
+		set = append(set, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+	set = append(set, "version=version+1")
+	args = append(args, id)
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE id=$%d RETURNING version",
+		table, strings.Join(set, ", "), len(args)), args
+}
+
+func patchString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func patchStringPtr(value interface{}) *string {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	return &s
+}
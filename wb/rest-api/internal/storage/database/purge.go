@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"time"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+const (
+	purgeMarkets = "DELETE FROM markets WHERE deleted_at < $1 RETURNING " + marketColumns
+	purgeClients = "DELETE FROM clients WHERE deleted_at < $1 " +
+		"AND NOT EXISTS(SELECT 1 FROM markets WHERE markets.owner = clients.id) RETURNING " + clientColumns
+)
+
+// RunPurge раз в purgeInterval окончательно удаляет записи, удаленные больше softDeleteRetention назад.
+// Блокируется до отмены ctx
+func RunPurge(ctx context.Context, storage Storage, dbConfig config.Database, logger *logging.Logger) {
+	retention := dbConfig.SoftDeleteRetention.Duration
+	if retention <= 0 {
+		logger.Info("purge of deleted records is disabled")
+		return
+	}
+
+	logger.Infof("purge deleted records older than %s every %s", retention, dbConfig.PurgeInterval.Duration)
+	// в журнале изменений окончательное удаление записывается от имени фоновой задачи
+	ctx = WithActor(ctx, Actor{Caller: "purge"})
+	ctx = logging.WithLogger(ctx, logger.GetLoggerWithField("caller", "purge"))
+	ticker := time.NewTicker(dbConfig.PurgeInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		purged, err := storage.Purge(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.Warningf("failed to purge deleted records: %v", err)
+		} else if purged > 0 {
+			logger.Infof("purged %d deleted records", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
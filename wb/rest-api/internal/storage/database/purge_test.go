@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wb/rest-api/internal/config"
+	"wb/rest-api/pkg/logging"
+)
+
+func TestMemoryPurge(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage(config.Database{OnClientDelete: config.OnDeleteCascade}, logging.GetLogger())
+
+	insert := func(mdl Model) string {
+		t.Helper()
+		id, err := storage.Insert(ctx, mdl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	client := func() Client {
+		return Client{LastName: "Sokolov", FirstName: "Petr", Patronymic: "Igorevich", RegistrationDate: "01-01-2012"}
+	}
+
+	owner := insert(client())
+	alone := insert(client())
+	market := insert(Market{Name: "Magnit", Address: "Moscow", Active: true, Owner: &owner})
+
+	// магазин удаляется каскадом вместе с владельцем
+	for _, id := range []string{alone, owner} {
+		id := id
+		if err := storage.Delete(ctx, Client{Id: &id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// записи, удаленные позже границы, не трогаются
+	if purged, err := storage.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("purge old records: purged %d, err %v", purged, err)
+	}
+
+	purged, err := storage.Purge(ctx, time.Now().Add(time.Second))
+	if err != nil || purged != 3 {
+		t.Fatalf("purge: purged %d, err %v, want 3", purged, err)
+	}
+	for _, mdl := range []Model{Client{Id: &owner}, Client{Id: &alone}, Market{Id: &market}} {
+		if _, err = storage.Get(ctx, mdl); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get purged %s %s: err %v", mdl.table(), mdl.key(), err)
+		}
+	}
+}
+
+func TestMemoryPurgeKeepsReferencedOwner(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage(config.Database{OnClientDelete: config.OnDeleteRestrict}, logging.GetLogger()).(*Memory)
+
+	owner, err := storage.Insert(ctx, Client{LastName: "Sokolov", FirstName: "Petr", Patronymic: "Igorevich",
+		RegistrationDate: "01-01-2012"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	market, err := storage.Insert(ctx, Market{Name: "Magnit", Address: "Moscow", Active: true, Owner: &owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// удаленный владелец остается, пока на него ссылается магазин
+	storage.tables[Client{}.table()][owner] = storage.tables[Client{}.table()][owner].withDeletedAt(&time.Time{})
+	if purged, err := storage.Purge(ctx, time.Now()); err != nil || purged != 0 {
+		t.Fatalf("purge: purged %d, err %v, want 0", purged, err)
+	}
+
+	if err = storage.Delete(ctx, Market{Id: &market}); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := storage.Purge(ctx, time.Now().Add(time.Second)); err != nil || purged != 2 {
+		t.Fatalf("purge: purged %d, err %v, want 2", purged, err)
+	}
+}
@@ -1,7 +1,12 @@
 package database
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/miladibra10/vjson"
+	"strings"
+	"time"
 	"wb/rest-api/pkg/logging"
 )
 
@@ -9,26 +14,168 @@ var _ Validator = Client{}
 var _ Validator = Market{}
 
 type Validator interface {
-	ValidateForList([]byte, *logging.Logger) error
 	ValidateForCreate([]byte, *logging.Logger) error
 	ValidateForUpdate([]byte, *logging.Logger) error
+	ValidateForPatch([]byte, *logging.Logger) error
 	ValidateForDelete([]byte, *logging.Logger) error
 }
 
-func (c Client) ValidateForList(data []byte, logger *logging.Logger) error {
-	clientSchema := vjson.NewSchema(
-		vjson.String("last_name").Required().MinLength(1).MaxLength(20),
-	)
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError содержит нарушения схемы по каждому полю запроса
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return "validation fail: " + strings.Join(messages, "; ")
+}
+
+// check -- дополнительная проверка, которую не умеет vjson
+type check func(values map[string]interface{}) []FieldError
+
+// dateField проверяет, что поле, если оно передано, содержит дату в формате "DD-MM-YYYY"
+func dateField(name string) check {
+	return func(values map[string]interface{}) []FieldError {
+		value, ok := values[name].(string)
+		if !ok {
+			return nil
+		}
+
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return []FieldError{{Field: name, Message: fmt.Sprintf("Value for %s field should be a date in DD-MM-YYYY format", name)}}
+		}
+		return nil
+	}
+}
+
+// uuidField проверяет, что поле, если оно передано, содержит UUID
+func uuidField(name string) check {
+	return func(values map[string]interface{}) []FieldError {
+		value, ok := values[name].(string)
+		if !ok {
+			return nil
+		}
+
+		if _, err := uuid.Parse(value); err != nil {
+			return []FieldError{{Field: name, Message: fmt.Sprintf("Value for %s field should be a valid uuid", name)}}
+		}
+		return nil
+	}
+}
+
+// notNull запрещает явный null для полей, которые нельзя очистить
+func notNull(names ...string) check {
+	return func(values map[string]interface{}) []FieldError {
+		var fieldErrors []FieldError
+		for _, name := range names {
+			if value, ok := values[name]; ok && value == nil {
+				fieldErrors = append(fieldErrors, FieldError{Field: name, Message: fmt.Sprintf("Value for %s field should not be null", name)})
+			}
+		}
+		return fieldErrors
+	}
+}
+
+// anyOf требует хотя бы одно из полей
+func anyOf(names ...string) check {
+	return func(values map[string]interface{}) []FieldError {
+		for _, name := range names {
+			if _, ok := values[name]; ok {
+				return nil
+			}
+		}
+		return []FieldError{{Field: "", Message: fmt.Sprintf("at least one of [%s] should be provided", strings.Join(names, ","))}}
+	}
+}
+
+// onlyFields отклоняет поля не из names: в PATCH опечатка в имени поля иначе молча ничего бы не изменила
+func onlyFields(names ...string) check {
+	return func(values map[string]interface{}) []FieldError {
+		var fieldErrors []FieldError
+		for _, name := range sortKeys(values) {
+			known := false
+			for _, allowed := range names {
+				known = known || name == allowed
+			}
+			if !known {
+				fieldErrors = append(fieldErrors, FieldError{Field: name, Message: fmt.Sprintf("unknown field %s", name)})
+			}
+		}
+		return fieldErrors
+	}
+}
 
-	err := clientSchema.ValidateBytes(data)
-	if err != nil {
+// validate проверяет поля по отдельности, чтобы не разбирать текст общей ошибки vjson
+func validate(schema vjson.Schema, data []byte, logger *logging.Logger, checks ...check) error {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
 		logger.Warningf("validation fail: %v", err)
-		return err
+		return &ValidationError{Fields: []FieldError{{Field: "", Message: "request body should be a json object"}}}
+	}
+
+	validationErr := &ValidationError{}
+	for _, field := range schema.Fields {
+		err := field.Validate(values[field.GetName()])
+		if err == nil {
+			continue
+		}
+
+		for _, e := range unwrapErrors(err) {
+			validationErr.Fields = append(validationErr.Fields, FieldError{
+				Field:   field.GetName(),
+				Message: e.Error(),
+			})
+		}
+	}
+
+	for _, c := range checks {
+		validationErr.Fields = append(validationErr.Fields, c(values)...)
+	}
+
+	if len(validationErr.Fields) > 0 {
+		logger.Warningf("%v", validationErr)
+		return validationErr
 	}
 
 	return nil
 }
 
+// vjson собирает несколько нарушений одного поля в multierror
+func unwrapErrors(err error) []error {
+	if multi, ok := err.(interface{ WrappedErrors() []error }); ok {
+		return multi.WrappedErrors()
+	}
+	return []error{err}
+}
+
+func (f ClientFilter) Validate(data []byte, logger *logging.Logger) error {
+	filterSchema := vjson.NewSchema(
+		vjson.String("last_name").MinLength(1).MaxLength(20),
+		vjson.String("first_name").MinLength(1).MaxLength(20),
+		vjson.String("patronymic").MinLength(1).MaxLength(20),
+		vjson.Integer("age_from").Range(1, 120),
+		vjson.Integer("age_to").Range(1, 120),
+		vjson.String("registration_date_from").MinLength(10).MaxLength(10),
+		vjson.String("registration_date_to").MinLength(10).MaxLength(10),
+		vjson.String("sort_by").Choices(sortKeys(clientSortColumns)...),
+		vjson.String("order").Choices(OrderAsc, OrderDesc),
+		vjson.Integer("limit").Range(1, MaxLimit),
+		vjson.String("page_token").MinLength(1),
+		vjson.Boolean("include_deleted"),
+	)
+
+	return validate(filterSchema, data, logger,
+		dateField("registration_date_from"), dateField("registration_date_to"))
+}
+
 func (c Client) ValidateForCreate(data []byte, logger *logging.Logger) error {
 	clientSchema := vjson.NewSchema(
 		vjson.String("last_name").Required().MinLength(1).MaxLength(20),
@@ -38,13 +185,7 @@ func (c Client) ValidateForCreate(data []byte, logger *logging.Logger) error {
 		vjson.String("registration_date").Required().MinLength(10).MaxLength(10),
 	)
 
-	err := clientSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
-
-	return nil
+	return validate(clientSchema, data, logger, dateField("registration_date"))
 }
 
 func (c Client) ValidateForUpdate(data []byte, logger *logging.Logger) error {
@@ -57,13 +198,22 @@ func (c Client) ValidateForUpdate(data []byte, logger *logging.Logger) error {
 		vjson.String("registration_date").Required().MinLength(10).MaxLength(10),
 	)
 
-	err := clientSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
+	return validate(clientSchema, data, logger, uuidField("id"), dateField("registration_date"))
+}
 
-	return nil
+func (c Client) ValidateForPatch(data []byte, logger *logging.Logger) error {
+	clientSchema := vjson.NewSchema(
+		vjson.String("id").Required().MinLength(1),
+		vjson.String("last_name").MinLength(1).MaxLength(20),
+		vjson.String("first_name").MinLength(1).MaxLength(20),
+		vjson.String("patronymic").MinLength(1).MaxLength(20),
+		vjson.Integer("age").Range(1, 120),
+		vjson.String("registration_date").MinLength(10).MaxLength(10),
+	)
+
+	return validate(clientSchema, data, logger, uuidField("id"), dateField("registration_date"),
+		notNull("last_name", "first_name", "patronymic", "registration_date"),
+		anyOf(sortKeys(clientPatchColumns)...), onlyFields(append(sortKeys(clientPatchColumns), "id")...))
 }
 
 func (c Client) ValidateForDelete(data []byte, logger *logging.Logger) error {
@@ -71,27 +221,23 @@ func (c Client) ValidateForDelete(data []byte, logger *logging.Logger) error {
 		vjson.String("id").Required().MinLength(1),
 	)
 
-	err := clientSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
-
-	return nil
+	return validate(clientSchema, data, logger, uuidField("id"))
 }
 
-func (m Market) ValidateForList(data []byte, logger *logging.Logger) error {
-	marketSchema := vjson.NewSchema(
-		vjson.String("name").Required().MinLength(1).MaxLength(20),
+func (f MarketFilter) Validate(data []byte, logger *logging.Logger) error {
+	filterSchema := vjson.NewSchema(
+		vjson.String("name").MinLength(1).MaxLength(20),
+		vjson.String("address").MinLength(1).MaxLength(50),
+		vjson.Boolean("active"),
+		vjson.String("owner"),
+		vjson.String("sort_by").Choices(sortKeys(marketSortColumns)...),
+		vjson.String("order").Choices(OrderAsc, OrderDesc),
+		vjson.Integer("limit").Range(1, MaxLimit),
+		vjson.String("page_token").MinLength(1),
+		vjson.Boolean("include_deleted"),
 	)
 
-	err := marketSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
-
-	return nil
+	return validate(filterSchema, data, logger, uuidField("owner"))
 }
 
 func (m Market) ValidateForCreate(data []byte, logger *logging.Logger) error {
@@ -99,16 +245,10 @@ func (m Market) ValidateForCreate(data []byte, logger *logging.Logger) error {
 		vjson.String("name").Required().MinLength(1).MaxLength(20),
 		vjson.String("address").Required().MinLength(1).MaxLength(50),
 		vjson.Boolean("active").Required(),
-		vjson.String("owner").MinLength(1).MaxLength(20),
+		vjson.String("owner"),
 	)
 
-	err := marketSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
-
-	return nil
+	return validate(marketSchema, data, logger, uuidField("owner"))
 }
 
 func (m Market) ValidateForUpdate(data []byte, logger *logging.Logger) error {
@@ -117,16 +257,24 @@ func (m Market) ValidateForUpdate(data []byte, logger *logging.Logger) error {
 		vjson.String("name").Required().MinLength(1).MaxLength(20),
 		vjson.String("address").Required().MinLength(1).MaxLength(50),
 		vjson.Boolean("active").Required(),
-		vjson.String("owner").MinLength(1).MaxLength(20),
+		vjson.String("owner"),
 	)
 
-	err := marketSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
+	return validate(marketSchema, data, logger, uuidField("id"), uuidField("owner"))
+}
 
-	return nil
+func (m Market) ValidateForPatch(data []byte, logger *logging.Logger) error {
+	marketSchema := vjson.NewSchema(
+		vjson.String("id").Required().MinLength(1),
+		vjson.String("name").MinLength(1).MaxLength(20),
+		vjson.String("address").MinLength(1).MaxLength(50),
+		vjson.Boolean("active"),
+		vjson.String("owner"),
+	)
+
+	return validate(marketSchema, data, logger, uuidField("id"), uuidField("owner"),
+		notNull("name", "address", "active"),
+		anyOf(sortKeys(marketPatchColumns)...), onlyFields(append(sortKeys(marketPatchColumns), "id")...))
 }
 
 func (m Market) ValidateForDelete(data []byte, logger *logging.Logger) error {
@@ -134,11 +282,5 @@ func (m Market) ValidateForDelete(data []byte, logger *logging.Logger) error {
 		vjson.String("id").Required().MinLength(1),
 	)
 
-	err := marketSchema.ValidateBytes(data)
-	if err != nil {
-		logger.Warningf("validation fail: %v", err)
-		return err
-	}
-
-	return nil
+	return validate(marketSchema, data, logger, uuidField("id"))
 }
@@ -0,0 +1,19 @@
+package logging
+
+import "context"
+
+type contextKey struct{}
+
+// WithLogger сохраняет логгер запроса в контексте
+func WithLogger(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext возвращает логгер запроса, а если его нет -- fallback.
+// Так фоновые задачи и код вне запросов логируют как раньше
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return logger
+	}
+	return fallback
+}
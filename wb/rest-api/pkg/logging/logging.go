@@ -66,6 +66,10 @@ func (logger *Logger) GetLoggerWithField(k string, v interface{}) *Logger {
 	return &Logger{logger.WithField(k, v)}
 }
 
+func (logger *Logger) GetLoggerWithFields(fields map[string]interface{}) *Logger {
+	return &Logger{logger.WithFields(fields)}
+}
+
 func init() {
 	l := logrus.New()
 	l.SetReportCaller(true)
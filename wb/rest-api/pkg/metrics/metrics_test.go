@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := reg.Counter("requests_total", "Requests.", "method", "path")
+	requests.Inc("GET", "/a")
+	requests.Add(2, "GET", "/a")
+	requests.Inc("POST", `/"b"`)
+
+	duration := reg.Histogram("duration_seconds", "Duration.", []float64{0.1, 1}, "method")
+	duration.Observe(0.05, "GET")
+	duration.Observe(0.5, "GET")
+	duration.Observe(5, "GET")
+
+	reg.GaugeFunc("connections", "Connections.", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/a"} 3
+requests_total{method="POST",path="/\"b\""} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{method="GET",le="0.1"} 1
+duration_seconds_bucket{method="GET",le="1"} 2
+duration_seconds_bucket{method="GET",le="+Inf"} 3
+duration_seconds_sum{method="GET"} 5.55
+duration_seconds_count{method="GET"} 3
+# HELP connections Connections.
+# TYPE connections gauge
+connections 3
+`
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestLabelValuesMismatch(t *testing.T) {
+	counter := NewRegistry().Counter("requests_total", "Requests.", "method")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on wrong number of label values")
+		}
+	}()
+	counter.Inc("GET", "/a")
+}